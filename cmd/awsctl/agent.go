@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/agent"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// agentCommand represents all of the context for the "agent" commands.
+type agentCommand struct {
+	socket      string
+	idleTimeout time.Duration
+	stsEndpoint string
+	profile     string
+	token       string
+	command     []string
+	*globalOptions
+}
+
+// credentials asks the agent for the session credentials of the profile.
+func (a *agentCommand) credentials() (*agent.Credentials, error) {
+	response, err := agent.Call(a.socket, agent.Request{Op: agent.OpCredentials, Profile: a.profile})
+	if err != nil {
+		return nil, err
+	}
+	return response.Credentials, nil
+}
+
+// environment returns the environment variables that hold the credentials.
+func environment(credentials *agent.Credentials) []string {
+	env := []string{
+		"AWS_ACCESS_KEY_ID=" + credentials.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY=" + credentials.SecretAccessKey,
+		"AWS_SESSION_TOKEN=" + credentials.SessionToken,
+	}
+	if credentials.Expiration != "" {
+		env = append(env, "AWS_CREDENTIAL_EXPIRATION="+credentials.Expiration)
+	}
+	return env
+}
+
+// start will execute the functionality for the "agent start" command.
+func (a *agentCommand) start(c *kingpin.ParseContext) error {
+	listener, err := agent.Listen(a.socket)
+	if err != nil {
+		return err
+	}
+
+	ag := &agent.Agent{
+		Credentials: a.session,
+		Authenticate: func(profile, token string) error {
+			return a.refreshSession(profile, a.stsEndpoint, token)
+		},
+		RefreshWindow: refreshWindow,
+		IdleTimeout:   a.idleTimeout,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			ag.Stop()
+		}
+	}()
+
+	logger.Info("Agent listening on %s.", a.socket)
+	if err = ag.Serve(listener); err != nil {
+		return err
+	}
+	logger.Info("Agent stopped.")
+	return nil
+}
+
+// auth will execute the functionality for the "agent auth" command. The agent
+// creates the new session, so parallel requests for the profile share it.
+func (a *agentCommand) auth(c *kingpin.ParseContext) error {
+	if a.token == "" {
+		if !interactive() {
+			return errors.New("--token is required when awsctl is not run interactively")
+		}
+		logger.Ask("Enter a MFA token to refresh the session of profile %s:", a.profile)
+		scanner := bufio.NewScanner(os.Stdin)
+		if !scanner.Scan() {
+			return errors.New("no MFA token entered")
+		}
+		a.token = strings.TrimSpace(scanner.Text())
+	}
+
+	response, err := agent.Call(a.socket, agent.Request{Op: agent.OpAuth, Profile: a.profile, Token: a.token})
+	if err != nil {
+		return err
+	}
+	if response.Credentials.Expiration != "" {
+		logger.Success("The agent refreshed the session of profile %s, it expires at %s.", a.profile, response.Credentials.Expiration)
+		return nil
+	}
+	logger.Success("The agent refreshed the session of profile %s.", a.profile)
+	return nil
+}
+
+// status will execute the functionality for the "agent status" command.
+func (a *agentCommand) status(c *kingpin.ParseContext) error {
+	response, err := agent.Call(a.socket, agent.Request{Op: agent.OpStatus})
+	if err != nil {
+		return err
+	}
+	status := response.Status
+
+	if a.output == outputJSON {
+		b, err := json.Marshal(status)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode status")
+		}
+		fmt.Fprintln(logger.Default.Out, string(b))
+		return nil
+	}
+
+	logger.Info("Agent %d listening on %s since %s.", status.PID, a.socket, status.Started.Format(time.RFC3339))
+	if status.IdleTimeout > 0 {
+		idle := time.Duration(status.IdleTimeout)*time.Second - time.Since(status.LastRequest)
+		logger.Info("Stopping when idle for another %s.", idle.Round(time.Second))
+	}
+	if len(status.Sessions) <= 0 {
+		logger.Info("No sessions are cached.")
+		return nil
+	}
+
+	var data [][]string
+	for _, session := range status.Sessions {
+		data = append(data, []string{session.Profile, session.Expiration})
+	}
+	return a.printTable([]string{"Profile", "Expiration"}, data)
+}
+
+// stop will execute the functionality for the "agent stop" command.
+func (a *agentCommand) stop(c *kingpin.ParseContext) error {
+	if _, err := agent.Call(a.socket, agent.Request{Op: agent.OpStop}); err != nil {
+		return err
+	}
+	logger.Success("Stopped the agent on %s.", a.socket)
+	return nil
+}
+
+// credentialProcess will execute the functionality for the
+// "agent credential-process" command. It prints the credentials in the format
+// of the credential_process setting of the AWS config file.
+func (a *agentCommand) credentialProcess(c *kingpin.ParseContext) error {
+	credentials, err := a.credentials()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(struct {
+		Version         int    `json:"Version"`
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		SessionToken    string `json:"SessionToken"`
+		Expiration      string `json:"Expiration,omitempty"`
+	}{
+		Version:         1,
+		AccessKeyID:     credentials.AccessKeyID,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Expiration:      credentials.Expiration,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode credentials")
+	}
+	fmt.Fprintln(logger.Default.Out, string(b))
+	return nil
+}
+
+// env will execute the functionality for the "agent env" command.
+func (a *agentCommand) env(c *kingpin.ParseContext) error {
+	credentials, err := a.credentials()
+	if err != nil {
+		return err
+	}
+	for _, variable := range environment(credentials) {
+		fmt.Fprintf(logger.Default.Out, "export %s\n", variable)
+	}
+	return nil
+}
+
+// exec will execute the functionality for the "agent exec" command. The
+// command's exit code becomes the exit code of awsctl.
+func (a *agentCommand) exec(c *kingpin.ParseContext) error {
+	credentials, err := a.credentials()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(a.command[0], a.command[1:]...)
+	cmd.Env = append(os.Environ(), environment(credentials)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Leave signals, such as a Ctrl-C, to the command.
+	signal.Ignore(os.Interrupt)
+	if err = cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		return errors.Wrapf(err, "failed to run %s", a.command[0])
+	}
+	return nil
+}
+
+// configureAgentCommand sets up the "agent" commands for the main
+// kingpin.Application.
+func configureAgentCommand(app *kingpin.Application, g *globalOptions) {
+	a := &agentCommand{
+		globalOptions: g,
+	}
+
+	ag := app.Command("agent", "Cache MFA sessions in a background agent, shared over a Unix socket.")
+	ag.Flag("socket", "Unix socket of the agent.").Envar("AWSCTL_AGENT_SOCKET").Default(agent.DefaultSocket()).StringVar(&a.socket)
+
+	start := ag.Command("start", "Run the agent.").Action(a.start)
+	start.Flag("idle-timeout", "Stop the agent after no credentials were requested for so long, 0 never stops it.").Default("1h").DurationVar(&a.idleTimeout)
+	start.Flag("sts-endpoint", "Custom STS endpoint URL.").Envar("AWS_ENDPOINT_URL_STS").StringVar(&a.stsEndpoint)
+
+	auth := ag.Command("auth", "Refresh the MFA session of a profile through the agent.").Action(a.auth)
+	auth.Flag("profile", "AWS profile to refresh the MFA session of.").Short('p').Required().HintAction(g.profileHints).StringVar(&a.profile)
+	auth.Flag("token", "MFA token, asked for on the terminal by default.").Short('t').StringVar(&a.token)
+
+	ag.Command("status", "Show the state of the agent.").Action(a.status)
+	ag.Command("stop", "Stop the agent, wiping the sessions it cached.").Action(a.stop)
+
+	process := ag.Command("credential-process", "Print the session credentials of a profile for the credential_process setting.").Action(a.credentialProcess)
+	process.Flag("profile", "AWS profile to print the MFA session of.").Short('p').Required().HintAction(g.profileHints).StringVar(&a.profile)
+
+	env := ag.Command("env", "Print the session credentials of a profile as shell exports.").Action(a.env)
+	env.Flag("profile", "AWS profile to print the MFA session of.").Short('p').Required().HintAction(g.profileHints).StringVar(&a.profile)
+
+	run := ag.Command("exec", "Run a command with the session credentials of a profile.").Action(a.exec)
+	run.Flag("profile", "AWS profile to use the MFA session of.").Short('p').Required().HintAction(g.profileHints).StringVar(&a.profile)
+	run.Arg("command", "Command to run, and its arguments.").Required().StringsVar(&a.command)
+}
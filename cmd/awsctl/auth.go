@@ -2,54 +2,222 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
-	ini "gopkg.in/ini.v1"
 
+	"github.com/outlawlabs/awsctl/pkg/audit"
 	"github.com/outlawlabs/awsctl/pkg/aws"
 	"github.com/outlawlabs/awsctl/pkg/logger"
+	"github.com/outlawlabs/awsctl/pkg/settings"
 )
 
 // authCommand represents all of the context for the "auth" command.
 type authCommand struct {
-	token           string
-	profile         string
-	duration        int64
-	configFile      string
-	credentialsFile string
+	token       string
+	profile     string
+	duration    string
+	stsEndpoint string
+	*globalOptions
 }
 
-func (a *authCommand) authenticate(credentials, config *ini.File, mfa, region string) error {
+// stsConfig returns how to reach STS for the profile in its region, see
+// stsConfig.
+func (a *authCommand) stsConfig(store *aws.Store) (aws.STSConfig, error) {
+	base, err := store.Profile(a.profile)
+	if err != nil {
+		return aws.STSConfig{}, err
+	}
+	return stsConfig(base, base.Region, a.stsEndpoint), nil
+}
+
+// pickProfile lets the user choose the profile to authenticate interactively.
+// Only base profiles with an MFA device are offered, together with the state of
+// their session.
+func (a *authCommand) pickProfile(store *aws.Store) (string, error) {
+	if !canPick() {
+		return "", errors.New("--profile is required when awsctl is not run interactively")
+	}
+
+	profiles, err := aws.ReadConfigFile(a.configFile)
+	if err != nil {
+		return "", err
+	}
+
+	sessions := store.Sessions()
+	var items []pickerItem
+	for _, p := range profiles {
+		if _, ok := sessions[p.Name]; ok || p.MFASerial == "" {
+			continue
+		}
+
+		session, err := store.SessionProfile(p.Name, a.sessionTemplates)
+		if err != nil {
+			return "", err
+		}
+		state, expiration := sessionState(store, session)
+		detail := state
+		if expiration != "" {
+			detail = fmt.Sprintf("%s (%s)", state, expiration)
+		}
+		items = append(items, pickerItem{name: p.Name, detail: detail})
+	}
+
+	if len(items) == 0 {
+		return "", fmt.Errorf("could not find any MFA profiles. See %s for help", awsCLIHelp)
+	}
+
+	return pick("Select a profile:", items)
+}
+
+// sessionDuration returns the duration of the new session: the --duration flag,
+// or else the profile's awsctl_session_duration, or else the duration of the
+// settings file, or else aws.DefaultSessionDuration. It must be within the
+// limits of GetSessionToken.
+func (a *authCommand) sessionDuration(store *aws.Store) (time.Duration, error) {
+	d, err := a.configuredDuration(store)
+	if err != nil {
+		return 0, err
+	}
+	if err = aws.GetSessionTokenLimits.Validate(d); err != nil {
+		return 0, err
+	}
+	return d, nil
+}
+
+func (a *authCommand) configuredDuration(store *aws.Store) (time.Duration, error) {
+	if a.duration != "" {
+		return aws.ParseDuration(a.duration)
+	}
+
+	if d, ok, err := store.SessionDuration(a.profile); err != nil || ok {
+		return d, err
+	}
+
+	if value := a.settings.Get(a.profile, settings.KeyDuration); value != "" {
+		d, err := aws.ParseDuration(value)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid setting in %s", a.settingsFile)
+		}
+		return d, nil
+	}
+
+	return aws.DefaultSessionDuration, nil
+}
+
+// authenticate creates a new MFA session for the profile and saves it. It
+// releases the lock of the locked store before it returns.
+func (a *authCommand) authenticate(store *aws.Store, mfa, sessionProfile string, duration time.Duration) (err error) {
+	record := audit.Record{
+		Profile:           a.profile,
+		Operation:         audit.OperationAuth,
+		MFASerial:         mfa,
+		RequestedDuration: int64(duration / time.Second),
+	}
+	var (
+		stsConfig aws.STSConfig
+		session   aws.Profile
+	)
+	defer func() {
+		record.ErrorClass = audit.ErrorClass(err)
+		// Release the lock of the AWS files before looking up the caller of
+		// the new session, which needs another request to STS.
+		store.Unlock()
+		if session.SessionToken != "" {
+			var lookupErr error
+			if record.CallerARN, lookupErr = aws.CallerARN(stsConfig, session); lookupErr != nil {
+				logger.Debug("Failed to look up the caller of the new session: %s.", lookupErr)
+			}
+		}
+		a.record(record)
+	}()
+
+	if stsConfig, err = a.stsConfig(store); err != nil {
+		return err
+	}
+
+	endpoint, signingRegion, err := stsConfig.Resolve()
+	if err != nil {
+		return err
+	}
+	logger.Debug("Using STS endpoint %s, signed for region %s.", endpoint, signingRegion)
+
+	// Sign the request with the keys of the base profile itself, whatever
+	// credentials the environment of awsctl points the AWS SDK at.
+	base, err := store.Profile(a.profile)
+	if err != nil {
+		return err
+	}
+
 	logger.Info("Attempting to authenticate with credentials for profile: %s.", a.profile)
-	prof, err := aws.Authenticate(a.duration, mfa, a.token)
+	prof, err := aws.Authenticate(stsConfig, base, int64(duration/time.Second), mfa, a.token)
 	if err != nil {
 		return err
 	}
 
-	mfaProfile := fmt.Sprintf("profile %s_mfa", a.profile)
-	config.Section(mfaProfile).Key(keyRegion).SetValue(region)
-	if err = config.SaveTo(a.configFile); err != nil {
-		return errors.Wrap(err, "failed to save new config file")
+	if expiration, ok := prof.SessionExpiration(); ok {
+		record.GrantedDuration = int64(time.Until(expiration).Round(time.Second) / time.Second)
 	}
 
-	mfaProfile = fmt.Sprintf("%s_mfa", a.profile)
-	credentials.Section(mfaProfile).Key(keyAccessKeyID).SetValue(prof.AccessKeyID)
-	credentials.Section(mfaProfile).Key(keySecretAccessKey).SetValue(prof.SecretAccessKey)
-	credentials.Section(mfaProfile).Key(keySessionToken).SetValue(prof.SessionToken)
-	credentials.Section(mfaProfile).Key(keyMFASerial).SetValue(prof.MFASerial)
-	credentials.Section(mfaProfile).Key(keyAuthenticationExpiration).SetValue(prof.AuthenticationExpiration)
-	if err = credentials.SaveTo(a.credentialsFile); err != nil {
-		return errors.Wrap(err, "failed to save new credentials file")
+	// Save the session and mirror the base profile's settings, e.g. region and
+	// output, into the session profile.
+	if err = store.SaveSession(a.profile, sessionProfile, prof); err != nil {
+		return err
 	}
+	session = prof
 
 	logger.Success("Successfully created a MFA authenticated session for profile: %s.", a.profile)
 
 	return nil
 }
 
+// refreshSession creates a new MFA session for the base profile with the MFA
+// token, just like "awsctl auth", for the long-running "serve" and "agent"
+// commands. Nothing is done if another awsctl process refreshed the session
+// while waiting for the lock of the AWS files.
+func (g *globalOptions) refreshSession(profile, stsEndpoint, token string) error {
+	a := &authCommand{
+		profile:       profile,
+		token:         token,
+		stsEndpoint:   stsEndpoint,
+		globalOptions: g,
+	}
+
+	store, err := g.lockStore()
+	if err != nil {
+		return err
+	}
+	defer store.Unlock()
+	if !store.HasProfile(profile) {
+		return aws.ProfileNotFoundError(profile)
+	}
+
+	if session, err := g.session(profile); err == nil {
+		if expiration, ok := session.SessionExpiration(); ok && time.Until(expiration) > refreshWindow {
+			logger.Info("The session of profile %s was already refreshed.", profile)
+			return nil
+		}
+	}
+
+	mfa := store.Config.Section(aws.ConfigSection(profile)).Value(keyMFASerial)
+	if mfa == "" {
+		return errors.Errorf("mfa_serial needs to be configured for the profile: %s", profile)
+	}
+
+	duration, err := a.sessionDuration(store)
+	if err != nil {
+		return err
+	}
+
+	sessionProfile, err := store.SessionProfile(profile, g.sessionTemplates)
+	if err != nil {
+		return err
+	}
+
+	return a.authenticate(store, mfa, sessionProfile, duration)
+}
+
 // run will execute the functionality for the "auth" command.
 func (a *authCommand) run(c *kingpin.ParseContext) error {
 
@@ -61,38 +229,77 @@ func (a *authCommand) run(c *kingpin.ParseContext) error {
 		return fmt.Errorf("~/.aws/credentials file error")
 	}
 
-	credentials, err := ini.Load(a.credentialsFile)
-	if err != nil {
-		return errors.Wrap(err, "failed to read credentials file")
+	if err := a.ensureFiles(); err != nil {
+		return err
 	}
 
-	config, err := ini.Load(a.configFile)
+	store, err := aws.OpenStore(a.configFile, a.credentialsFile)
 	if err != nil {
-		return errors.Wrap(err, "failed to read config file")
+		return err
+	}
+
+	if a.profile == "" {
+		if a.profile, err = a.pickProfile(store); err != nil {
+			return err
+		}
 	}
 
-	if err = os.Setenv("AWS_SDK_LOAD_CONFIG", "true"); err != nil {
-		return errors.Wrap(err, "failed to set AWS_SDK_LOAD_CONFIG value")
+	// Hold the lock of the AWS files until the session is saved. Concurrent
+	// "awsctl auth" runs for the profile wait for it, then find the new
+	// session below rather than spending another MFA token.
+	if store, err = a.lockStore(); err != nil {
+		return err
 	}
+	defer store.Unlock()
 
-	if err = os.Setenv("AWS_PROFILE", a.profile); err != nil {
-		return errors.Wrap(err, "failed to set AWS_PROFILE value")
+	if !store.HasProfile(a.profile) {
+		return aws.ProfileNotFoundError(a.profile)
 	}
 
-	configProfile := fmt.Sprintf("profile %s", a.profile)
-	if !config.Section(configProfile).HasKey(keyMFASerial) {
+	configProfile := store.Config.Section(aws.ConfigSection(a.profile))
+	logger.Debug("Using config section [%s] of profile: %s.", aws.ConfigSection(a.profile), a.profile)
+	if !configProfile.HasKey(keyMFASerial) {
 		return fmt.Errorf("mfa_serial needs to bet configured for the profile: %s", a.profile)
 	}
-	if !config.Section(configProfile).HasKey(keyRegion) {
+	if !configProfile.HasKey(keyRegion) {
 		return fmt.Errorf("region needs to bet configured for the profile: %s", a.profile)
 	}
 
-	mfa := config.Section(configProfile).Key(keyMFASerial).String()
-	region := config.Section(configProfile).Key(keyRegion).String()
+	mfa := configProfile.Value(keyMFASerial)
+
+	duration, err := a.sessionDuration(store)
+	if err != nil {
+		return err
+	}
+
+	// Bring existing session profiles in line with the naming template first,
+	// so a still valid session is picked up under its new name.
+	renames, err := store.MigrateSession(a.profile, a.sessionTemplates)
+	if err != nil {
+		return err
+	}
+	if len(renames) > 0 {
+		if err = store.Save(); err != nil {
+			return err
+		}
+		for _, r := range renames {
+			if r.To == "" {
+				logger.Info("Removed session profile %s, another session of %s is fresher.", r.From, r.Base)
+				continue
+			}
+			logger.Info("Renamed session profile %s to %s.", r.From, r.To)
+		}
+	}
+
+	sessionProfile, err := store.SessionProfile(a.profile, a.sessionTemplates)
+	if err != nil {
+		return err
+	}
 
-	mfaProfile := fmt.Sprintf("%s_mfa", a.profile)
-	if credentials.Section(mfaProfile).HasKey(keyAuthenticationExpiration) {
-		authenticationExpiration := credentials.Section(mfaProfile).Key(keyAuthenticationExpiration).String()
+	mfaProfile := store.Credentials.Section(aws.CredentialsSection(sessionProfile))
+	logger.Debug("Using credentials section [%s] of session profile: %s.", aws.CredentialsSection(sessionProfile), sessionProfile)
+	if mfaProfile.HasKey(keyAuthenticationExpiration) {
+		authenticationExpiration := mfaProfile.Value(keyAuthenticationExpiration)
 
 		currentTime := time.Now()
 		parsedAuthenticationExpiration, err := time.Parse(time.RFC3339, authenticationExpiration)
@@ -103,29 +310,29 @@ func (a *authCommand) run(c *kingpin.ParseContext) error {
 		if currentTime.Before(parsedAuthenticationExpiration) {
 			logger.Info("Your current MFA session has not expired yet for profile: %s.", a.profile)
 		} else {
-			if err = a.authenticate(credentials, config, mfa, region); err != nil {
+			if err = a.authenticate(store, mfa, sessionProfile, duration); err != nil {
 				return err
 			}
 		}
 	} else {
-		if err = a.authenticate(credentials, config, mfa, region); err != nil {
+		if err = a.authenticate(store, mfa, sessionProfile, duration); err != nil {
 			return err
 		}
 	}
 
-	logger.Always("Activate your MFA profile: export AWS_PROFILE=%s_mfa", a.profile)
+	logger.Always("Activate your MFA profile: export AWS_PROFILE=%s", sessionProfile)
 	return nil
 }
 
 // configureAuthCommand sets up the "auth" command for the main
 // kingpin.Application.
-func configureAuthCommand(app *kingpin.Application, configFile, credentialsFile string) {
+func configureAuthCommand(app *kingpin.Application, g *globalOptions) {
 	c := &authCommand{
-		configFile:      configFile,
-		credentialsFile: credentialsFile,
+		globalOptions: g,
 	}
 	auth := app.Command("auth", "MFA authentication.").Action(c.run)
 	auth.Flag("token", "One time MFA token.").Short('t').StringVar(&c.token)
-	auth.Flag("profile", "AWS specific profile.").Short('p').StringVar(&c.profile)
-	auth.Flag("duration", "Active MFA auth duration.").Short('d').Int64Var(&c.duration)
+	auth.Flag("profile", "AWS specific profile.").Short('p').HintAction(g.profileHints).StringVar(&c.profile)
+	auth.Flag("duration", "Active MFA auth duration, in seconds or e.g. 12h or 90m.").Short('d').Envar("AWSCTL_DURATION").StringVar(&c.duration)
+	auth.Flag("sts-endpoint", "Custom STS endpoint URL.").Envar("AWS_ENDPOINT_URL_STS").StringVar(&c.stsEndpoint)
 }
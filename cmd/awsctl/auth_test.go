@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/settings"
+)
+
+func TestSessionDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settingsFile := filepath.Join(dir, "settings")
+	if err = ioutil.WriteFile(settingsFile, []byte(`[global]
+duration = 8h
+
+[profile configured]
+duration = 4h
+
+[profile broken]
+duration = forever
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := settings.Load(settingsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := settings.Load(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &aws.Store{
+		Config: aws.ParseFile([]byte(`[profile own]
+awsctl_session_duration = 2h
+[profile configured]
+[profile plain]
+[profile broken]
+`)),
+		Credentials: aws.ParseFile(nil),
+	}
+
+	tests := []struct {
+		name     string
+		profile  string
+		flag     string
+		settings *settings.Settings
+		want     time.Duration
+		err      bool
+	}{
+		{"flag", "own", "1h", s, time.Hour, false},
+		{"profile key", "own", "", s, 2 * time.Hour, false},
+		{"profile setting", "configured", "", s, 4 * time.Hour, false},
+		{"global setting", "plain", "", s, 8 * time.Hour, false},
+		{"default", "plain", "", empty, aws.DefaultSessionDuration, false},
+		{"too short", "plain", "5m", s, 0, true},
+		{"too long", "plain", "2d", s, 0, true},
+		{"invalid flag", "plain", "soon", s, 0, true},
+		{"invalid setting", "broken", "", s, 0, true},
+	}
+
+	for _, test := range tests {
+		a := &authCommand{
+			profile:       test.profile,
+			duration:      test.flag,
+			globalOptions: &globalOptions{settings: test.settings, settingsFile: settingsFile},
+		}
+		got, err := a.sessionDuration(store)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("%s: sessionDuration() = %s, %v, want %s, error %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
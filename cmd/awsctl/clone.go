@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// cloneCommand represents all of the context for the "clone" command.
+type cloneCommand struct {
+	srcProfile string
+	dstProfile string
+	*globalOptions
+}
+
+// run will execute the functionality for the "clone" command.
+func (cl *cloneCommand) run(c *kingpin.ParseContext) error {
+
+	if cl.configFile == "" {
+		return errors.New("~/.aws/config file error")
+	}
+
+	if cl.credentialsFile == "" {
+		return errors.New("~/.aws/credentials file error")
+	}
+
+	store, err := cl.lockStore()
+	if err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	if err = aws.CloneProfile(cl.srcProfile, cl.dstProfile, cl.sessionTemplates, store); err != nil {
+		return err
+	}
+
+	logger.Success("Successfully cloned profile %s to %s.", cl.srcProfile, cl.dstProfile)
+	return nil
+}
+
+// configureCloneCommand sets up the "clone" command for the main
+// kingpin.Application.
+func configureCloneCommand(app *kingpin.Application, g *globalOptions) {
+	cl := &cloneCommand{
+		globalOptions: g,
+	}
+	clone := app.Command("clone", "Copy an existing AWS profile together with its MFA sessions.").Action(cl.run)
+	clone.Arg("src", "AWS profile to copy.").Required().HintAction(g.profileHints).StringVar(&cl.srcProfile)
+	clone.Arg("dst", "Name of the new AWS profile.").Required().StringVar(&cl.dstProfile)
+}
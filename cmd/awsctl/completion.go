@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"text/template"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+// fishCompletionTemplate hooks fish up to kingpin's --completion-bash flag,
+// which prints the possible completions for the given arguments.
+const fishCompletionTemplate = `function __{{.App.Name}}_complete
+    set -l args (commandline -opc)
+    set -e args[1]
+    {{.App.Name}} --completion-bash $args (commandline -ct) 2>/dev/null
+end
+complete -c {{.App.Name}} -f -a '(__{{.App.Name}}_complete)'
+`
+
+// completionCommand represents all of the context for the "completion"
+// command.
+type completionCommand struct {
+	shell string
+	app   *kingpin.Application
+}
+
+// run will execute the functionality for the "completion" command.
+func (c *completionCommand) run(ctx *kingpin.ParseContext) error {
+
+	scripts := map[string]string{
+		"bash": kingpin.BashCompletionTemplate,
+		"zsh":  kingpin.ZshCompletionTemplate,
+		"fish": fishCompletionTemplate,
+	}
+
+	t, err := template.New(c.shell).Parse(scripts[c.shell])
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s completion script", c.shell)
+	}
+
+	data := struct{ App struct{ Name string } }{}
+	data.App.Name = c.app.Name
+	if err = t.Execute(os.Stdout, data); err != nil {
+		return errors.Wrapf(err, "failed to generate %s completion script", c.shell)
+	}
+
+	return nil
+}
+
+// profileHints completes the names of base profiles, leaving out the session
+// profiles created by "awsctl auth".
+func (g *globalOptions) profileHints() []string {
+	store, err := aws.OpenStore(g.configFile, g.credentialsFile)
+	if err != nil {
+		return nil
+	}
+	profiles, err := store.Profiles()
+	if err != nil {
+		return nil
+	}
+
+	sessions := store.Sessions()
+	var names []string
+	for _, p := range profiles {
+		if _, ok := sessions[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// allProfileHints completes the names of every profile, including session
+// profiles.
+func (g *globalOptions) allProfileHints() []string {
+	store, err := aws.OpenStore(g.configFile, g.credentialsFile)
+	if err != nil {
+		return nil
+	}
+	profiles, err := store.Profiles()
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// regionHints completes the names of every known AWS region.
+func regionHints() []string {
+	var names []string
+	for _, r := range aws.Regions() {
+		names = append(names, r.ID)
+	}
+	return names
+}
+
+// configureCompletionCommand sets up the "completion" command for the main
+// kingpin.Application.
+func configureCompletionCommand(app *kingpin.Application) {
+	c := &completionCommand{
+		app: app,
+	}
+	completion := app.Command("completion", `Generate a shell completion script, e.g. eval "$(awsctl completion bash)".`).Action(c.run)
+	completion.Arg("shell", "Shell to generate the script for.").Required().EnumVar(&c.shell, "bash", "zsh", "fish")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/logger"
+	"github.com/outlawlabs/awsctl/pkg/settings"
+)
+
+// configCommand represents all of the context for the "config" command.
+type configCommand struct {
+	key     string
+	value   string
+	profile string
+	*globalOptions
+}
+
+// get will execute the functionality for the "config get" command.
+func (cf *configCommand) get(c *kingpin.ParseContext) error {
+	if err := settings.Validate(cf.profile, cf.key, ""); err != nil {
+		return err
+	}
+
+	value := cf.settings.Get(cf.profile, cf.key)
+	if value == "" {
+		return errors.Errorf("%s is not set", cf.key)
+	}
+
+	fmt.Fprintln(logger.Default.Out, value)
+	return nil
+}
+
+// set will execute the functionality for the "config set" command.
+func (cf *configCommand) set(c *kingpin.ParseContext) error {
+	if err := cf.settings.Set(cf.profile, cf.key, cf.value); err != nil {
+		return err
+	}
+	if err := cf.settings.Save(); err != nil {
+		return err
+	}
+
+	if cf.value == "" {
+		logger.Success("Successfully unset %s.", cf.key)
+	} else {
+		logger.Success("Successfully set %s to %s.", cf.key, cf.value)
+	}
+	return nil
+}
+
+// list will execute the functionality for the "config list" command.
+func (cf *configCommand) list(c *kingpin.ParseContext) error {
+	var data [][]string
+	for _, s := range cf.settings.List() {
+		if cf.profile != "" && s.Profile != cf.profile {
+			continue
+		}
+		data = append(data, []string{s.Profile, s.Key, s.Value})
+	}
+
+	if len(data) <= 0 {
+		logger.Warning("Could not find any settings in: %s.", cf.settingsFile)
+	}
+
+	return cf.printTable([]string{"Profile", "Key", "Value"}, data)
+}
+
+// configureConfigCommand sets up the "config" command for the main
+// kingpin.Application.
+func configureConfigCommand(app *kingpin.Application, g *globalOptions) {
+	cf := &configCommand{
+		globalOptions: g,
+	}
+	keys := []string{settings.KeyDuration, settings.KeyOutput, settings.KeySessionTemplate}
+
+	config := app.Command("config", "Manage the awsctl settings file.")
+
+	get := config.Command("get", "Print a setting.").Action(cf.get)
+	get.Arg("key", "Setting to print.").Required().HintOptions(keys...).StringVar(&cf.key)
+	get.Flag("profile", "AWS profile to print the setting of.").Short('p').HintAction(g.profileHints).StringVar(&cf.profile)
+
+	set := config.Command("set", "Set a setting, an empty value removes it.").Action(cf.set)
+	set.Arg("key", "Setting to set.").Required().HintOptions(keys...).StringVar(&cf.key)
+	set.Arg("value", "Value of the setting.").Required().StringVar(&cf.value)
+	set.Flag("profile", "AWS profile to set the setting for.").Short('p').HintAction(g.profileHints).StringVar(&cf.profile)
+
+	list := config.Command("list", "List every setting.").Action(cf.list)
+	list.Flag("profile", "Only list the settings of the AWS profile.").Short('p').HintAction(g.profileHints).StringVar(&cf.profile)
+}
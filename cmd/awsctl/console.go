@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/audit"
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// consoleCommand represents all of the context for the "console" command.
+type consoleCommand struct {
+	profile            string
+	service            string
+	region             string
+	duration           string
+	open               bool
+	federationEndpoint string
+	stsEndpoint        string
+	policy             string
+	policyARNs         []string
+	*globalOptions
+}
+
+// credentials returns temporary credentials of the profile that can sign in to
+// the console, and the duration of the console session to request for them.
+// Role profiles assume their role with the MFA session, or the keys, of their
+// source_profile. The credentials of MFA sessions cannot sign in to the
+// console, so base profiles, which need an active MFA session if they have an
+// MFA device, request a federation token with their keys instead. It is scoped
+// by --policy and --policy-arn, or else read-only.
+func (c *consoleCommand) credentials(store *aws.Store, p aws.Profile, region string) (aws.Profile, int64, error) {
+	var duration time.Duration
+	if c.duration != "" {
+		var err error
+		if duration, err = aws.ParseDuration(c.duration); err != nil {
+			return aws.Profile{}, 0, err
+		}
+	}
+
+	if p.IsRole() {
+		if duration != 0 {
+			if err := aws.ConsoleSessionLimits.Validate(duration); err != nil {
+				return aws.Profile{}, 0, err
+			}
+		}
+		creds, err := c.roleCredentials(store, p, stsConfig(p, region, c.stsEndpoint))
+		return creds, int64(duration / time.Second), err
+	}
+
+	if p.MFASerial != "" {
+		if _, err := c.activeSession(p.Name); err != nil {
+			return aws.Profile{}, 0, err
+		}
+	}
+
+	if duration == 0 {
+		duration = aws.DefaultSessionDuration
+	}
+	if err := aws.FederationTokenLimits.Validate(duration); err != nil {
+		return aws.Profile{}, 0, err
+	}
+
+	policy := aws.FederationPolicy{Document: c.policy, ARNs: c.policyARNs}
+	if policy.Document == "" && len(policy.ARNs) == 0 {
+		policy = aws.ReadOnlyPolicy(region)
+	}
+
+	logger.Debug("Requesting a federation token for profile: %s.", p.Name)
+	creds, arn, err := aws.FederationToken(stsConfig(p, region, c.stsEndpoint), p, int64(duration/time.Second), policy)
+	record := audit.Record{
+		Profile:           p.Name,
+		Operation:         audit.OperationFederate,
+		CallerARN:         arn,
+		RequestedDuration: int64(duration / time.Second),
+		ErrorClass:        audit.ErrorClass(err),
+	}
+	if expiration, ok := creds.SessionExpiration(); ok {
+		record.GrantedDuration = int64(time.Until(expiration).Round(time.Second) / time.Second)
+	}
+	c.record(record)
+
+	// The console session of a federated user lasts as long as its token.
+	return creds, 0, err
+}
+
+// run will execute the functionality for the "console" command.
+func (c *consoleCommand) run(ctx *kingpin.ParseContext) error {
+
+	store, err := aws.OpenStore(c.configFile, c.credentialsFile)
+	if err != nil {
+		return err
+	}
+	if !store.HasProfile(c.profile) {
+		return aws.ProfileNotFoundError(c.profile)
+	}
+
+	p, err := store.Profile(c.profile)
+	if err != nil {
+		return err
+	}
+
+	region, err := profileRegion(store, p, c.region)
+	if err != nil {
+		return err
+	}
+
+	federation, console, err := aws.ConsoleEndpoints(region)
+	if err != nil && c.federationEndpoint == "" {
+		return err
+	}
+	if c.federationEndpoint != "" {
+		federation = c.federationEndpoint
+	}
+	if console == "" {
+		console = "https://console.aws.amazon.com/"
+	}
+
+	service := c.service
+	if service == "" {
+		service = "console"
+	}
+	destination := fmt.Sprintf("%s%s/home?region=%s", console, service, region)
+
+	creds, sessionDuration, err := c.credentials(store, p, region)
+	if err != nil {
+		return err
+	}
+
+	signinURL, err := aws.SigninURL(federation, destination, creds, sessionDuration)
+	if err != nil {
+		return err
+	}
+
+	if !c.open {
+		fmt.Fprintln(logger.Default.Out, signinURL)
+		return nil
+	}
+
+	if err = openBrowser(signinURL); err != nil {
+		return err
+	}
+	logger.Success("Opened the AWS console for profile: %s.", c.profile)
+	return nil
+}
+
+// openBrowser opens the URL in the default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "failed to open a browser, print the URL without --open instead")
+	}
+	return nil
+}
+
+// configureConsoleCommand sets up the "console" command for the main
+// kingpin.Application.
+func configureConsoleCommand(app *kingpin.Application, g *globalOptions) {
+	c := &consoleCommand{
+		globalOptions: g,
+	}
+	console := app.Command("console", "Sign in to the AWS console with a profile.").Action(c.run)
+	console.Flag("profile", "AWS profile to sign in with.").Short('p').Required().HintAction(g.profileHints).StringVar(&c.profile)
+	console.Flag("service", "Console of the service to open, e.g. ec2.").Short('s').StringVar(&c.service)
+	console.Flag("region", "Region to open the console in, the profile's region by default.").Short('r').StringVar(&c.region)
+	console.Flag("duration", "Duration of the console session, e.g. 1h.").Short('d').StringVar(&c.duration)
+	console.Flag("policy", "Policy document that scopes the federation token of a base profile.").StringVar(&c.policy)
+	console.Flag("policy-arn", "Managed policy that scopes the federation token of a base profile, repeatable.").StringsVar(&c.policyARNs)
+	console.Flag("open", "Open the sign-in URL in a browser instead of printing it.").BoolVar(&c.open)
+	console.Flag("federation-endpoint", "Custom federation endpoint URL.").Envar("AWSCTL_FEDERATION_ENDPOINT").StringVar(&c.federationEndpoint)
+	console.Flag("sts-endpoint", "Custom STS endpoint URL.").Envar("AWS_ENDPOINT_URL_STS").StringVar(&c.stsEndpoint)
+}
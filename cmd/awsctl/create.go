@@ -7,21 +7,21 @@ import (
 
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
-	ini "gopkg.in/ini.v1"
 
+	"github.com/outlawlabs/awsctl/pkg/audit"
 	"github.com/outlawlabs/awsctl/pkg/aws"
 	"github.com/outlawlabs/awsctl/pkg/logger"
 )
 
 // newCommand represents all of the context for the "new" command.
 type newCommand struct {
-	profile         string
-	region          string
-	accessKey       string
-	secretKey       string
-	mfaSerial       string
-	configFile      string
-	credentialsFile string
+	profile            string
+	region             string
+	accessKey          string
+	secretKey          string
+	mfaSerial          string
+	allowUnknownRegion bool
+	*globalOptions
 }
 
 // run will execute the functionality for the "new" command.
@@ -35,33 +35,18 @@ func (n *newCommand) run(c *kingpin.ParseContext) error {
 		return errors.New("~/.aws/credentials file error")
 	}
 
-	credentials, err := ini.Load(n.credentialsFile)
-	if err != nil {
-		return errors.Wrap(err, "failed to read credentials file")
+	if err := n.ensureFiles(); err != nil {
+		return err
 	}
 
-	config, err := ini.Load(n.configFile)
+	store, err := aws.OpenStore(n.configFile, n.credentialsFile)
 	if err != nil {
-		return errors.Wrap(err, "failed to read config file")
+		return err
 	}
 
-	// Create the template for the new AWS CLI profile.
-	configProfile := fmt.Sprintf("profile %s", n.profile)
-
-	// Ignore error -- *should* only come back as not found if the section does
-	// not exist already.
-	sections := config.SectionStrings()
-	for i := 0; i < len(sections); i++ {
-		if sections[i] == configProfile {
-			return errors.New("cannot create new profile, it already exists")
-		}
-	}
-	// Also check for the same section header within the credentials file.
-	sections = credentials.SectionStrings()
-	for i := 0; i < len(sections); i++ {
-		if sections[i] == configProfile {
-			return errors.New("cannot create new profile, it already exists")
-		}
+	// Check for the profile within both the config and credentials files.
+	if store.HasProfile(n.profile) {
+		return errors.Wrap(aws.ProfileExistsError(n.profile), "cannot create new profile")
 	}
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -83,13 +68,36 @@ func (n *newCommand) run(c *kingpin.ParseContext) error {
 
 	fmt.Println("")
 	logger.Info("Working on your new AWS profile: %s", n.profile)
-	profile, err := aws.NewProfile(n.profile, region, mfaSerial, accessKeyID, secretAccessKey)
+	profile, err := aws.NewProfile(n.profile, region, mfaSerial, accessKeyID, secretAccessKey, n.allowUnknownRegion)
 	if err != nil {
 		return err
 	}
 
+	if r, _ := aws.LookupRegion(region, true); r.Partition != nil {
+		logger.Info("Region %s belongs to the %s partition.", region, r.Partition.ID)
+	} else {
+		logger.Warning("Region %s is not known to awsctl yet.", region)
+	}
+
+	// Only lock the AWS files now, so other awsctl processes do not have to
+	// wait for the prompts, and check for the profile again.
+	if store, err = n.lockStore(); err != nil {
+		return err
+	}
+	defer store.Unlock()
+	if store.HasProfile(n.profile) {
+		return errors.Wrap(aws.ProfileExistsError(n.profile), "cannot create new profile")
+	}
+
 	// Save the new profile to respective files.
-	if err := profile.Save(config, credentials, n.configFile, n.credentialsFile); err != nil {
+	err = profile.Save(store)
+	n.record(audit.Record{
+		Profile:    n.profile,
+		Operation:  audit.OperationNew,
+		MFASerial:  mfaSerial,
+		ErrorClass: audit.ErrorClass(err),
+	})
+	if err != nil {
 		return err
 	}
 
@@ -100,11 +108,11 @@ func (n *newCommand) run(c *kingpin.ParseContext) error {
 
 // configureNewCommand sets up the "new" command for the main
 // kingpin.Application.
-func configureNewCommand(app *kingpin.Application, configFile, credentialsFile string) {
+func configureNewCommand(app *kingpin.Application, g *globalOptions) {
 	n := &newCommand{
-		configFile:      configFile,
-		credentialsFile: credentialsFile,
+		globalOptions: g,
 	}
 	new := app.Command("new", "Save a new AWS profile & credential pair.").Action(n.run)
 	new.Arg("profile", "AWS profile to create.").Required().StringVar(&n.profile)
+	new.Flag("allow-unknown-region", "Accept regions that are not known to awsctl yet.").BoolVar(&n.allowUnknownRegion)
 }
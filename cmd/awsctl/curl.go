@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// hostRegion matches the region within the host names of AWS endpoints, e.g.
+// "abc123.execute-api.eu-west-1.amazonaws.com".
+var hostRegion = regexp.MustCompile(`\.([a-z]{2}(?:-[a-z]+)+-\d+)\.amazonaws\.com(?:\.cn)?$`)
+
+// keepDataFiles protects the flag values of the "curl" command that start with
+// "@", such as "--data @FILE", from kingpin, which would otherwise replace them
+// by the lines of the file, by rewriting them to "--data=@FILE". Only the
+// arguments of the "curl" command itself are rewritten, so e.g. "awsctl agent
+// exec -- curl -d @FILE" is left alone.
+func keepDataFiles(app *kingpin.Application, args []string) []string {
+	model := app.Model()
+
+	// The command is the first argument that is neither a flag nor the value
+	// of one.
+	i := 0
+	for i < len(args) && args[i] != "--" && strings.HasPrefix(args[i], "-") {
+		if _, flag := valueFlag(model.Flags, args[i]); flag != nil {
+			i++
+		}
+		i++
+	}
+	if i >= len(args) || args[i] != "curl" {
+		return args
+	}
+
+	flags := model.Flags
+	for _, command := range model.Commands {
+		if command.Name == "curl" {
+			flags = append(append([]*kingpin.FlagModel(nil), flags...), command.Flags...)
+		}
+	}
+
+	out := append([]string(nil), args[:i+1]...)
+	for i++; i < len(args); i++ {
+		// kingpin does not expand anything after "--".
+		if args[i] == "--" {
+			return append(out, args[i:]...)
+		}
+		bools, flag := valueFlag(flags, args[i])
+		if flag != nil && i+1 < len(args) && strings.HasPrefix(args[i+1], "@") {
+			if bools != "" {
+				out = append(out, bools)
+			}
+			out = append(out, fmt.Sprintf("--%s=%s", flag.Name, args[i+1]))
+			i++
+			continue
+		}
+		out = append(out, args[i])
+	}
+	return out
+}
+
+// valueFlag returns the flag that takes the next argument as its value, if arg
+// is such a flag: "--name" or "-n", or a group of short flags such as "-vn"
+// that ends in it, in which case the preceding boolean flags, e.g. "-v", are
+// returned as well.
+func valueFlag(flags []*kingpin.FlagModel, arg string) (string, *kingpin.FlagModel) {
+	if strings.HasPrefix(arg, "--") {
+		for _, flag := range flags {
+			if arg == "--"+flag.Name && !flag.IsBoolFlag() {
+				return "", flag
+			}
+		}
+		return "", nil
+	}
+
+	shorts := []rune(strings.TrimPrefix(arg, "-"))
+	if !strings.HasPrefix(arg, "-") || len(shorts) == 0 {
+		return "", nil
+	}
+	short := func(r rune) *kingpin.FlagModel {
+		for _, flag := range flags {
+			if flag.Short == r {
+				return flag
+			}
+		}
+		return nil
+	}
+	for _, r := range shorts[:len(shorts)-1] {
+		if flag := short(r); flag == nil || !flag.IsBoolFlag() {
+			return "", nil
+		}
+	}
+	flag := short(shorts[len(shorts)-1])
+	if flag == nil || flag.IsBoolFlag() {
+		return "", nil
+	}
+	if len(shorts) == 1 {
+		return "", flag
+	}
+	return "-" + string(shorts[:len(shorts)-1]), flag
+}
+
+// curlCommand represents all of the context for the "curl" command.
+type curlCommand struct {
+	profile         string
+	service         string
+	region          string
+	method          string
+	data            string
+	headers         []string
+	query           []string
+	unsignedPayload bool
+	presign         bool
+	expires         time.Duration
+	fail            bool
+	stsEndpoint     string
+	url             string
+	*globalOptions
+}
+
+// body returns the request body given by --data: the contents of a file for
+// "@file", standard input for "@-", or else the value itself.
+func (c *curlCommand) body() ([]byte, error) {
+	switch {
+	case c.data == "@-":
+		b, err := ioutil.ReadAll(os.Stdin)
+		return b, errors.Wrap(err, "failed to read request body from standard input")
+	case strings.HasPrefix(c.data, "@"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(c.data, "@"))
+		return b, errors.Wrap(err, "failed to read request body")
+	}
+	return []byte(c.data), nil
+}
+
+// request builds the request to sign, without its body.
+func (c *curlCommand) request() (*http.Request, error) {
+	u, err := url.Parse(c.url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf("invalid URL: %s", c.url)
+	}
+
+	if len(c.query) > 0 {
+		query := u.Query()
+		for _, parameter := range c.query {
+			parts := strings.SplitN(parameter, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("query parameter must be KEY=VALUE: %s", parameter)
+			}
+			query.Add(parts[0], parts[1])
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	method := c.method
+	if method == "" {
+		method = http.MethodGet
+		if c.data != "" {
+			method = http.MethodPost
+		}
+	}
+
+	r, err := http.NewRequest(strings.ToUpper(method), u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	for _, header := range c.headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Errorf("header must be NAME: VALUE: %s", header)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if strings.EqualFold(name, "Host") {
+			r.Host = value
+			continue
+		}
+		r.Header.Add(name, value)
+	}
+	return r, nil
+}
+
+// printResponse prints the status and headers of the response to standard
+// error and its body to standard output, or all of it as a JSON object with
+// --output json.
+func (c *curlCommand) printResponse(resp *http.Response) error {
+	if c.output == outputJSON {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return errors.Wrap(err, "failed to read response")
+		}
+		headers := map[string]string{}
+		for name, values := range resp.Header {
+			headers[name] = strings.Join(values, ", ")
+		}
+		b, err := json.Marshal(map[string]interface{}{
+			"status":  resp.StatusCode,
+			"headers": headers,
+			"body":    string(body),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to encode response")
+		}
+		fmt.Fprintln(logger.Default.Out, string(b))
+		return nil
+	}
+
+	fmt.Fprintf(logger.Default.Err, "%s %s\n", resp.Proto, resp.Status)
+	var names []string
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			fmt.Fprintf(logger.Default.Err, "%s: %s\n", name, value)
+		}
+	}
+	fmt.Fprintln(logger.Default.Err)
+
+	if _, err := io.Copy(logger.Default.Out, resp.Body); err != nil {
+		return errors.Wrap(err, "failed to read response")
+	}
+	return nil
+}
+
+// run will execute the functionality for the "curl" command.
+func (c *curlCommand) run(ctx *kingpin.ParseContext) error {
+
+	r, err := c.request()
+	if err != nil {
+		return err
+	}
+
+	body, err := c.body()
+	if err != nil {
+		return err
+	}
+
+	store, err := aws.OpenStore(c.configFile, c.credentialsFile)
+	if err != nil {
+		return err
+	}
+	if !store.HasProfile(c.profile) {
+		return aws.ProfileNotFoundError(c.profile)
+	}
+	p, err := store.Profile(c.profile)
+	if err != nil {
+		return err
+	}
+
+	region := c.region
+	if match := hostRegion.FindStringSubmatch(r.URL.Hostname()); region == "" && match != nil {
+		region = match[1]
+	}
+	if region, err = profileRegion(store, p, region); err != nil {
+		return err
+	}
+	logger.Debug("Signing for service %s in region %s.", c.service, region)
+
+	creds, err := c.signingCredentials(store, p, stsConfig(p, region, c.stsEndpoint))
+	if err != nil {
+		return err
+	}
+
+	if c.presign {
+		header, err := aws.PresignRequest(r, body, creds, c.service, region, c.expires, c.unsignedPayload)
+		if err != nil {
+			return err
+		}
+		for name, values := range header {
+			if !strings.EqualFold(name, "Host") {
+				logger.Info("Send the header along with the URL: %s: %s", name, strings.Join(values, ", "))
+			}
+		}
+		fmt.Fprintln(logger.Default.Out, r.URL.String())
+		return nil
+	}
+
+	if err = aws.SignRequest(r, body, creds, c.service, region, c.unsignedPayload); err != nil {
+		return err
+	}
+
+	// Redirects are not followed, they would send the signature elsewhere.
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+
+	if err = c.printResponse(resp); err != nil {
+		return err
+	}
+	if c.fail && resp.StatusCode >= 400 {
+		return errors.Errorf("request failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// configureCurlCommand sets up the "curl" command for the main
+// kingpin.Application.
+func configureCurlCommand(app *kingpin.Application, g *globalOptions) {
+	c := &curlCommand{
+		globalOptions: g,
+	}
+	curl := app.Command("curl", "Send an HTTP request signed with the credentials of a profile.").Action(c.run)
+	curl.Flag("profile", "AWS profile to sign the request with.").Short('p').Required().HintAction(g.profileHints).StringVar(&c.profile)
+	curl.Flag("service", "Service to sign the request for.").Default("execute-api").StringVar(&c.service)
+	curl.Flag("region", "Region to sign the request for, by default the region of the URL or the profile.").Short('r').StringVar(&c.region)
+	curl.Flag("request", "Request method, GET or POST with --data by default.").Short('X').StringVar(&c.method)
+	curl.Flag("data", "Request body, @FILE reads it from a file and @- from standard input.").Short('d').StringVar(&c.data)
+	curl.Flag("header", "Request header, NAME: VALUE. Can be repeated.").Short('H').StringsVar(&c.headers)
+	curl.Flag("query", "Query parameter, KEY=VALUE. Can be repeated.").StringsVar(&c.query)
+	curl.Flag("unsigned-payload", "Do not sign the request body.").BoolVar(&c.unsignedPayload)
+	curl.Flag("presign", "Print a presigned URL instead of sending the request.").BoolVar(&c.presign)
+	curl.Flag("expires", "Expiration of presigned URLs.").Default("15m").DurationVar(&c.expires)
+	curl.Flag("fail", "Fail on HTTP errors, status 400 and above.").Short('f').BoolVar(&c.fail)
+	curl.Flag("sts-endpoint", "Custom STS endpoint URL.").Envar("AWS_ENDPOINT_URL_STS").StringVar(&c.stsEndpoint)
+	curl.Arg("url", "URL to request.").Required().StringVar(&c.url)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// execCredentialAPIVersion is the version of the ExecCredential objects
+// printed unless kubectl asks for another one.
+const execCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// eksCommand represents all of the context for the "eks" commands.
+type eksCommand struct {
+	profile     string
+	cluster     string
+	region      string
+	apiVersion  string
+	stsEndpoint string
+	*globalOptions
+}
+
+// execCredential is the object kubectl expects from exec credential plugins.
+type execCredential struct {
+	Kind       string               `json:"kind"`
+	APIVersion string               `json:"apiVersion"`
+	Spec       struct{}             `json:"spec"`
+	Status     execCredentialStatus `json:"status"`
+}
+
+type execCredentialStatus struct {
+	ExpirationTimestamp string `json:"expirationTimestamp"`
+	Token               string `json:"token"`
+}
+
+// newExecCredential returns the ExecCredential of the token, which expires at
+// expiration.
+func newExecCredential(apiVersion, token string, expiration time.Time) execCredential {
+	return execCredential{
+		Kind:       "ExecCredential",
+		APIVersion: apiVersion,
+		Status: execCredentialStatus{
+			ExpirationTimestamp: expiration.UTC().Format(time.RFC3339),
+			Token:               token,
+		},
+	}
+}
+
+// execAPIVersion returns the ExecCredential version to print: --api-version,
+// or else the version kubectl asks for with KUBERNETES_EXEC_INFO.
+func (e *eksCommand) execAPIVersion() string {
+	if e.apiVersion != "" {
+		return e.apiVersion
+	}
+
+	var info struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if value := os.Getenv("KUBERNETES_EXEC_INFO"); value != "" {
+		if err := json.Unmarshal([]byte(value), &info); err != nil {
+			logger.Debug("Ignoring invalid KUBERNETES_EXEC_INFO: %s.", err)
+		}
+	}
+	if info.APIVersion != "" {
+		return info.APIVersion
+	}
+	return execCredentialAPIVersion
+}
+
+// token will execute the functionality for the "eks token" command.
+func (e *eksCommand) token(c *kingpin.ParseContext) error {
+
+	store, err := aws.OpenStore(e.configFile, e.credentialsFile)
+	if err != nil {
+		return err
+	}
+	if !store.HasProfile(e.profile) {
+		return aws.ProfileNotFoundError(e.profile)
+	}
+	p, err := store.Profile(e.profile)
+	if err != nil {
+		return err
+	}
+
+	region, err := profileRegion(store, p, e.region)
+	if err != nil {
+		return err
+	}
+	config := stsConfig(p, region, e.stsEndpoint)
+
+	creds, err := e.signingCredentials(store, p, config)
+	if err != nil {
+		return err
+	}
+
+	token, expiration, err := aws.EKSToken(config, creds, e.cluster)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(newExecCredential(e.execAPIVersion(), token, expiration))
+	if err != nil {
+		return errors.Wrap(err, "failed to encode ExecCredential")
+	}
+	fmt.Fprintln(logger.Default.Out, string(b))
+	return nil
+}
+
+// configureEKSCommand sets up the "eks" commands for the main
+// kingpin.Application.
+func configureEKSCommand(app *kingpin.Application, g *globalOptions) {
+	e := &eksCommand{
+		globalOptions: g,
+	}
+	eks := app.Command("eks", "Authenticate to Amazon EKS clusters.")
+
+	token := eks.Command("token", "Print an ExecCredential with a token for an EKS cluster, for kubectl.").Action(e.token)
+	token.Flag("profile", "AWS profile to authenticate with.").Short('p').Required().HintAction(g.profileHints).StringVar(&e.profile)
+	token.Flag("cluster", "Name of the EKS cluster.").Short('c').Required().StringVar(&e.cluster)
+	token.Flag("region", "Region of the STS endpoint, the profile's region by default.").Short('r').StringVar(&e.region)
+	token.Flag("api-version", "API version of the ExecCredential, by default the one kubectl asks for.").StringVar(&e.apiVersion)
+	token.Flag("sts-endpoint", "Custom STS endpoint URL.").Envar("AWS_ENDPOINT_URL_STS").StringVar(&e.stsEndpoint)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNewExecCredential(t *testing.T) {
+	expiration := time.Date(2020, 1, 2, 4, 18, 5, 0, time.FixedZone("CET", 3600))
+
+	b, err := json.Marshal(newExecCredential(execCredentialAPIVersion, "k8s-aws-v1.token", expiration))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"kind":"ExecCredential","apiVersion":"client.authentication.k8s.io/v1beta1","spec":{},` +
+		`"status":{"expirationTimestamp":"2020-01-02T03:18:05Z","token":"k8s-aws-v1.token"}}`
+	if string(b) != want {
+		t.Errorf("got %s\nwant %s", b, want)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/audit"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// historyCommand represents all of the context for the "history" command.
+type historyCommand struct {
+	profiles  []string
+	operation string
+	result    string
+	since     string
+	limit     int
+	*globalOptions
+}
+
+// defaultAuditLog returns the location of the audit log, following the XDG
+// base directory specification for state files.
+func defaultAuditLog() string {
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "awsctl", "audit.log")
+	}
+	return "~/.local/state/awsctl/audit.log"
+}
+
+// record appends r to the audit log. A failure to do so is logged, but does
+// not fail the command that is being recorded.
+func (g *globalOptions) record(r audit.Record) {
+	r.Time = time.Now().UTC()
+	if r.Result == "" {
+		r.Result = audit.ResultSuccess
+	}
+	if r.ErrorClass != "" {
+		r.Result = audit.ResultFailure
+	}
+
+	if err := audit.NewLog(g.auditLog).Append(r); err != nil {
+		logger.Warning("Failed to record %s of profile %s in the audit log: %s.", r.Operation, r.Profile, err)
+	}
+}
+
+// parseSince accepts a duration relative to now, e.g. 24h, an RFC3339
+// timestamp or a date.
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("--since must be a duration (e.g. 24h) or a date, not %q", since)
+}
+
+// run will execute the functionality for the "history" command.
+func (h *historyCommand) run(c *kingpin.ParseContext) error {
+
+	filter := audit.Filter{
+		Profiles:  h.profiles,
+		Operation: h.operation,
+		Result:    h.result,
+	}
+	if h.since != "" {
+		since, err := parseSince(h.since)
+		if err != nil {
+			return err
+		}
+		filter.Since = since
+	}
+
+	records, err := audit.NewLog(h.auditLog).Records(filter)
+	if err != nil {
+		return err
+	}
+	if h.limit > 0 && len(records) > h.limit {
+		records = records[len(records)-h.limit:]
+	}
+
+	// Unlike the table, the JSON output holds the complete records.
+	if h.output == outputJSON {
+		if records == nil {
+			records = []audit.Record{}
+		}
+		b, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to encode audit records")
+		}
+		fmt.Fprintln(logger.Default.Out, string(b))
+		return nil
+	}
+
+	if len(records) <= 0 {
+		logger.Warning("Could not find any audit records in: %s.", h.auditLog)
+		return nil
+	}
+
+	headers := []string{"Time", "Profile", "Operation", "Result", "Caller ARN", "Duration"}
+	var data [][]string
+	for _, r := range records {
+		result := r.Result
+		if r.ErrorClass != "" {
+			result = fmt.Sprintf("%s (%s)", r.Result, r.ErrorClass)
+		}
+		duration := ""
+		if r.GrantedDuration > 0 {
+			duration = (time.Duration(r.GrantedDuration) * time.Second).String()
+		} else if r.RequestedDuration > 0 {
+			duration = strconv.FormatInt(r.RequestedDuration, 10) + "s requested"
+		}
+		data = append(data, []string{r.Time.Local().Format(time.RFC3339), r.Profile, r.Operation, result, r.CallerARN, duration})
+	}
+
+	return h.printTable(headers, data)
+}
+
+// configureHistoryCommand sets up the "history" command for the main
+// kingpin.Application.
+func configureHistoryCommand(app *kingpin.Application, g *globalOptions) {
+	h := &historyCommand{
+		globalOptions: g,
+	}
+	history := app.Command("history", "Show the audit log of authentications and profile changes.").Action(h.run)
+	history.Flag("profile", "Only show records of the AWS profile, repeatable.").Short('p').HintAction(g.allProfileHints).StringsVar(&h.profiles)
+	history.Flag("operation", "Only show records of the operation.").
+		EnumVar(&h.operation, audit.OperationAuth, audit.OperationAssume, audit.OperationFederate, audit.OperationNew, audit.OperationRemove, audit.OperationUpdate)
+	history.Flag("result", "Only show records with the result.").EnumVar(&h.result, audit.ResultSuccess, audit.ResultFailure)
+	history.Flag("since", "Only show records since a duration ago (e.g. 24h) or a date.").StringVar(&h.since)
+	history.Flag("limit", "Only show the most recent records.").IntVar(&h.limit)
+}
@@ -12,7 +12,27 @@ import (
 
 // listCommand represents all of the context for the "list" command.
 type listCommand struct {
-	configFile string
+	*globalOptions
+}
+
+// profileType returns a short description of how the profile authenticates.
+func profileType(p aws.Profile, sessions map[string]string) string {
+	if _, ok := sessions[p.Name]; ok {
+		return "session"
+	}
+	switch {
+	case p.IsSSO():
+		return "sso"
+	case p.IsRole():
+		return "role"
+	case p.CredentialProcess != "":
+		return "process"
+	case p.SessionToken != "":
+		return "session"
+	case p.MFASerial != "":
+		return "mfa"
+	}
+	return "keys"
 }
 
 // run will execute the functionality for the "list" command.
@@ -22,32 +42,39 @@ func (l *listCommand) run(c *kingpin.ParseContext) error {
 		return fmt.Errorf("~/.aws/config file error")
 	}
 
-	profiles, err := aws.ReadConfigFile(l.configFile)
+	if l.credentialsFile == "" {
+		return fmt.Errorf("~/.aws/credentials file error")
+	}
+
+	store, err := aws.OpenStore(l.configFile, l.credentialsFile)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := store.Profiles()
 	if err != nil {
 		return errors.Wrap(err, "failed to read/parse config file")
 	}
 
 	if len(profiles) <= 0 {
 		logger.Warning("Could not find any profiles. See %s for help.", awsCLIHelp)
-		return nil
 	}
 
-	headers := []string{"Profile", "MFA Device Serial ARN", "Region"}
+	sessions := store.Sessions()
+	headers := []string{"Profile", "Type", "MFA Device Serial ARN", "Region"}
 	var data [][]string
 	for _, value := range profiles {
-		data = append(data, []string{value.Name, value.MFASerial, value.Region})
+		data = append(data, []string{value.Name, profileType(value, sessions), value.MFASerial, value.Region})
 	}
 	// Print pretty ASCII table of data.
-	logger.Table(headers, data)
-
-	return nil
+	return l.printTable(headers, data)
 }
 
 // configureListCommand sets up the "list" command for the main
 // kingpin.Application.
-func configureListCommand(app *kingpin.Application, configFile, credentialsFile string) {
+func configureListCommand(app *kingpin.Application, g *globalOptions) {
 	c := &listCommand{
-		configFile: configFile,
+		globalOptions: g,
 	}
 	app.Command("list", "List all AWS profiles.").Action(c.run)
 }
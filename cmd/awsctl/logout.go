@@ -0,0 +1,93 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// logoutCommand represents all of the context for the "logout" command.
+type logoutCommand struct {
+	profiles    []string
+	all         bool
+	expiredOnly bool
+	*globalOptions
+}
+
+// run will execute the functionality for the "logout" command.
+func (l *logoutCommand) run(c *kingpin.ParseContext) error {
+
+	if l.configFile == "" {
+		return errors.New("~/.aws/config file error")
+	}
+
+	if l.credentialsFile == "" {
+		return errors.New("~/.aws/credentials file error")
+	}
+
+	// Garbage collecting expired sessions applies to every profile unless
+	// specific profiles are given.
+	all := l.all || (l.expiredOnly && len(l.profiles) == 0)
+	if !all && len(l.profiles) == 0 {
+		return errors.New("specify the profiles to log out of, or use --all")
+	}
+	if all && len(l.profiles) > 0 {
+		return errors.New("cannot combine profiles with --all")
+	}
+
+	store, err := l.lockStore()
+	if err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	var matches []string
+	if all {
+		profiles, err := store.Profiles()
+		if err != nil {
+			return err
+		}
+		for _, p := range profiles {
+			matches = append(matches, p.Name)
+		}
+	} else {
+		matches, err = store.MatchProfiles(l.profiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	wiped, err := store.Logout(matches, l.expiredOnly, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(wiped) <= 0 {
+		logger.Info("There are no sessions to log out of.")
+		return nil
+	}
+
+	if err = store.Save(); err != nil {
+		return err
+	}
+
+	for _, profile := range wiped {
+		logger.Success("Successfully removed the session credentials of profile: %s.", profile)
+	}
+	return nil
+}
+
+// configureLogoutCommand sets up the "logout" command for the main
+// kingpin.Application.
+func configureLogoutCommand(app *kingpin.Application, g *globalOptions) {
+	l := &logoutCommand{
+		globalOptions: g,
+	}
+	logout := app.Command("logout", "Remove local MFA session credentials.").Action(l.run)
+	logout.Arg("profiles", "AWS profiles or glob patterns, e.g. dev-*, to log out of.").HintAction(g.allProfileHints).StringsVar(&l.profiles)
+	logout.Flag("all", "Log out of every profile.").BoolVar(&l.all)
+	logout.Flag("expired-only", "Only remove sessions that have expired.").BoolVar(&l.expiredOnly)
+}
@@ -2,21 +2,27 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/mattn/go-isatty"
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
-	ini "gopkg.in/ini.v1"
 
+	"github.com/outlawlabs/awsctl/pkg/audit"
+	"github.com/outlawlabs/awsctl/pkg/aws"
 	"github.com/outlawlabs/awsctl/pkg/logger"
+	"github.com/outlawlabs/awsctl/pkg/settings"
 )
 
 const (
-	defaultAWSDirectory = "~/.aws"
-	credentialsFile     = "~/.aws/credentials"
-	configFile          = "~/.aws/config"
+	credentialsFile = "~/.aws/credentials"
+	configFile      = "~/.aws/config"
 
 	keyAccessKeyID              = "aws_access_key_id"
 	keySecretAccessKey          = "aws_secret_access_key"
@@ -25,6 +31,11 @@ const (
 	keyRegion                   = "region"
 	keyLastAuthentication       = "last_authentication"
 	keyAuthenticationExpiration = "authentication_expiration"
+	keySessionDuration          = "awsctl_session_duration"
+	keyDurationSeconds          = "duration_seconds"
+
+	logFormatText = "text"
+	logFormatJSON = "json"
 
 	awsCLIHelp = "https://docs.aws.amazon.com/cli/latest/userguide/cli-chap-configure.html"
 
@@ -42,64 +53,433 @@ var (
 
 func main() {
 
-	// Set the global ini constants to not require pretty formatting.
-	ini.PrettyFormat = false
-	ini.PrettyEqual = true
+	app := kingpin.New("awsctl", "CLI tool to help manage multiple AWS profiles with MFA enabled.").
+		Author("github.com/outlawlabs").
+		Version(fmt.Sprintf(versionTemplate, version, timestamp, commitHash))
+
+	g := &globalOptions{}
+	app.Flag("config-file", "AWS config file to use.").
+		Envar("AWS_CONFIG_FILE").Default(configFile).StringVar(&g.configFile)
+	app.Flag("credentials-file", "AWS shared credentials file to use.").
+		Envar("AWS_SHARED_CREDENTIALS_FILE").Default(credentialsFile).StringVar(&g.credentialsFile)
+	app.Flag("session-template", "Naming template of MFA session profiles, e.g. {{.Name}}-mfa.").
+		Envar("AWSCTL_SESSION_TEMPLATE").StringVar(&g.sessionTemplates.Override)
+	app.Flag("settings-file", "awsctl settings file to use.").
+		Envar("AWSCTL_SETTINGS_FILE").Default(settings.DefaultPath()).StringVar(&g.settingsFile)
+	app.Flag("audit-log", "Audit log of authentications and profile changes.").
+		Envar("AWSCTL_AUDIT_LOG").Default(defaultAuditLog()).StringVar(&g.auditLog)
+	app.Flag("lock-timeout", "How long to wait for other awsctl processes changing the AWS files.").
+		Envar("AWSCTL_LOCK_TIMEOUT").Default("30s").DurationVar(&g.lockTimeout)
+	app.Flag("verbose", "Log more details, repeat for even more details.").Short('v').CounterVar(&g.verbose)
+	app.Flag("quiet", "Only log errors.").Short('q').BoolVar(&g.quiet)
+	app.Flag("no-color", "Disable colored output.").BoolVar(&g.noColor)
+	app.Flag("log-timestamps", "Prefix logs with a timestamp.").BoolVar(&g.logTimestamps)
+	app.Flag("log-format", "Format of logs, text or json (one object per line).").
+		Default(logFormatText).EnumVar(&g.logFormat, logFormatText, logFormatJSON)
+	app.PreAction(g.configureLogger)
+	app.PreAction(g.expand)
+	app.PreAction(g.loadSettings)
+
+	configureAgentCommand(app, g)
+	configureAuthCommand(app, g)
+	configureCloneCommand(app, g)
+	configureCompletionCommand(app)
+	configureConfigCommand(app, g)
+	configureConsoleCommand(app, g)
+	configureCurlCommand(app, g)
+	configureEKSCommand(app, g)
+	configureHistoryCommand(app, g)
+	configureListCommand(app, g)
+	configureLogoutCommand(app, g)
+	configureMigrateCommand(app, g)
+	configureNewCommand(app, g)
+	configureRemoveCommand(app, g)
+	configureRenameCommand(app, g)
+	configureServeCommand(app, g)
+	configureStatusCommand(app, g)
+	configureUpdateCommand(app, g)
+	app.Flag("output", "Output format, table or json.").Short('o').
+		Envar("AWSCTL_OUTPUT").EnumVar(&g.output, outputTable, outputJSON)
+
+	if _, err := app.Parse(keepDataFiles(app, os.Args[1:])); err != nil {
+		os.Exit(g.fail(app, err))
+	}
+}
+
+// exitCodes maps the kinds of errors to the documented exit codes of awsctl.
+// Any other error exits with 1.
+var exitCodes = map[aws.ErrorKind]int{
+	aws.ErrorProfileNotFound: 3,
+	aws.ErrorProfileExists:   4,
+	aws.ErrorInvalidMFAToken: 5,
+	aws.ErrorAccessDenied:    6,
+	aws.ErrorExpiredSession:  7,
+	aws.ErrorThrottled:       8,
+	aws.ErrorFileIO:          9,
+	aws.ErrorLockTimeout:     10,
+}
+
+// fail reports err, as a JSON object with --output json, and returns the exit
+// code for it.
+func (g *globalOptions) fail(app *kingpin.Application, err error) int {
+	kind := aws.KindOf(err)
+	code, ok := exitCodes[kind]
+	if !ok {
+		code = 1
+	}
+
+	if g.output != outputJSON {
+		app.Errorf("%s, try --help", err)
+		return code
+	}
+
+	b, jerr := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"kind":      kind,
+			"message":   err.Error(),
+			"exit_code": code,
+		},
+	})
+	if jerr != nil {
+		app.Errorf("%s, try --help", err)
+		return code
+	}
+	fmt.Fprintln(logger.Default.Err, string(b))
+	return code
+}
+
+// globalOptions represents the context shared by every command, such as the
+// location of the AWS config and credentials files.
+type globalOptions struct {
+	configFile       string
+	credentialsFile  string
+	sessionTemplates aws.SessionTemplates
+	auditLog         string
+	settingsFile     string
+	settings         *settings.Settings
+	lockTimeout      time.Duration
+	verbose          int
+	quiet            bool
+	noColor          bool
+	logTimestamps    bool
+	logFormat        string
+	output           string
+}
+
+// configureLogger applies the logging flags to the default logger. Colors are
+// disabled with --no-color, the NO_COLOR environment variable or when standard
+// output or standard error is not a terminal. It is run as a
+// kingpin.Application pre-action.
+func (g *globalOptions) configureLogger(c *kingpin.ParseContext) error {
+	if g.quiet && g.verbose > 0 {
+		return errors.New("--quiet and --verbose cannot be used together")
+	}
+
+	switch {
+	case g.quiet:
+		logger.SetLevel(1)
+	default:
+		logger.SetLevel(logger.Default.Level + g.verbose)
+	}
+
+	terminal := func(f *os.File) bool {
+		return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+	}
+	if g.noColor || os.Getenv("NO_COLOR") != "" || !terminal(os.Stdout) || !terminal(os.Stderr) {
+		logger.SetColor(false)
+	}
+
+	logger.SetTimestamps(g.logTimestamps)
+	logger.Default.JSON = g.logFormat == logFormatJSON
+	return nil
+}
+
+// expand resolves a leading "~" within the configured file paths. It is run as
+// a kingpin.Application pre-action, once all of the flags have been parsed.
+func (g *globalOptions) expand(c *kingpin.ParseContext) error {
+	configFile, err := homedir.Expand(g.configFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to expand %s", g.configFile)
+	}
+
+	credentialsFile, err := homedir.Expand(g.credentialsFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to expand %s", g.credentialsFile)
+	}
 
-	awsDirectory, err := homedir.Expand(defaultAWSDirectory)
+	auditLog, err := homedir.Expand(g.auditLog)
 	if err != nil {
-		logger.Critical("Failed to expand %s: %s.", defaultAWSDirectory, err)
-		os.Exit(1)
+		return errors.Wrapf(err, "failed to expand %s", g.auditLog)
 	}
 
-	credentialsFile, err := homedir.Expand(credentialsFile)
+	settingsFile, err := homedir.Expand(g.settingsFile)
 	if err != nil {
-		logger.Critical("Failed to expand ~/.aws/credentials file: %s.", err)
-		os.Exit(1)
+		return errors.Wrapf(err, "failed to expand %s", g.settingsFile)
 	}
 
-	configFile, err := homedir.Expand(configFile)
+	g.configFile = configFile
+	g.credentialsFile = credentialsFile
+	g.auditLog = auditLog
+	g.settingsFile = settingsFile
+	logger.Debug("Using AWS config file: %s.", g.configFile)
+	logger.Debug("Using AWS credentials file: %s.", g.credentialsFile)
+	logger.Debug("Using audit log: %s.", g.auditLog)
+	logger.Debug("Using settings file: %s.", g.settingsFile)
+	return nil
+}
+
+// loadSettings reads the awsctl settings file and applies its global defaults
+// to the options that were not set by a flag or environment variable. It is
+// run as a kingpin.Application pre-action, after expand. Invalid settings are
+// ignored rather than reported for the commands that do not use them, so
+// "awsctl config" can still fix them and shell completion keeps working.
+func (g *globalOptions) loadSettings(c *kingpin.ParseContext) error {
+	s, err := settings.Load(g.settingsFile)
 	if err != nil {
-		logger.Critical("Failed to expand ~/.aws/config file: %s.", err)
-		os.Exit(1)
+		return err
 	}
+	g.settings = s
+	strict := usesSettings(c)
 
-	if _, err := os.Stat(credentialsFile); os.IsNotExist(err) {
-		// Ensure the default ~/.aws directory exists.
-		if err = os.MkdirAll(awsDirectory, os.ModePerm); err != nil {
-			logger.Critical("Failed to make directory: %s. Error: %s.", awsDirectory, err)
+	// The global template only applies to base profiles without a template
+	// of their own, unlike --session-template.
+	g.sessionTemplates.Global = s.Get("", settings.KeySessionTemplate)
+	if err = settings.Validate("", settings.KeySessionTemplate, g.sessionTemplates.Global); err != nil {
+		if strict {
+			return errors.Wrapf(err, "invalid setting in %s", g.settingsFile)
 		}
+		g.sessionTemplates.Global = ""
+	}
 
-		file, err := os.Create(credentialsFile)
-		if err != nil {
-			logger.Critical("Failed to create file: %s. Error: %s.", credentialsFile, err)
-			os.Exit(1)
+	if g.output == "" {
+		g.output = s.Get("", settings.KeyOutput)
+		if err = settings.Validate("", settings.KeyOutput, g.output); err != nil {
+			if strict {
+				return errors.Wrapf(err, "invalid setting in %s", g.settingsFile)
+			}
+			g.output = ""
 		}
-		if err = file.Close(); err != nil {
-			logger.Warning("Failed to close credentials file.")
+	}
+	if g.output == "" {
+		g.output = outputTable
+	}
+	return nil
+}
+
+// usesSettings reports whether the parsed command depends on the global
+// defaults of the settings file. The "config" and "completion" commands, and
+// completing the command line with --completion-bash, do not.
+func usesSettings(c *kingpin.ParseContext) bool {
+	for _, element := range c.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok && flag.Model().Name == "completion-bash" {
+			return false
+		}
+	}
+	if c.SelectedCommand == nil {
+		return true
+	}
+	command := strings.Fields(c.SelectedCommand.FullCommand())
+	return len(command) == 0 || (command[0] != "config" && command[0] != "completion")
+}
+
+// printTable prints the rows as a table, or as a JSON array of objects keyed
+// by the snake_case headers with --output json. An empty table is not printed
+// at all, but as an empty JSON array.
+func (g *globalOptions) printTable(headers []string, data [][]string) error {
+	if g.output != outputJSON {
+		if len(data) > 0 {
+			logger.Table(headers, data)
 		}
+		return nil
 	}
 
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		file, err := os.Create(configFile)
+	rows := make([]map[string]string, 0, len(data))
+	for _, values := range data {
+		row := map[string]string{}
+		for i, header := range headers {
+			row[strings.ToLower(strings.Replace(header, " ", "_", -1))] = values[i]
+		}
+		rows = append(rows, row)
+	}
+	b, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode table")
+	}
+	fmt.Fprintln(logger.Default.Out, string(b))
+	return nil
+}
+
+// ensureFiles will create the AWS config and credentials files, as well as
+// their parent directories, if they do not exist yet. Only commands that write
+// to the files should call this.
+func (g *globalOptions) ensureFiles() error {
+	for _, filename := range []string{g.configFile, g.credentialsFile} {
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			continue
+		}
+
+		directory := filepath.Dir(filename)
+		if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+			return &aws.Error{Kind: aws.ErrorFileIO, Err: errors.Wrapf(err, "failed to make directory: %s", directory)}
+		}
+
+		file, err := os.Create(filename)
 		if err != nil {
-			logger.Critical("Failed to create file: %s. Error: %s.", configFile, err)
-			os.Exit(1)
+			return &aws.Error{Kind: aws.ErrorFileIO, Err: errors.Wrapf(err, "failed to create file: %s", filename)}
 		}
 		if err = file.Close(); err != nil {
-			logger.Warning("Failed to close config file.")
+			logger.Warning("Failed to close file: %s.", filename)
 		}
 	}
 
-	app := kingpin.New("awsctl", "CLI tool to help manage multiple AWS profiles with MFA enabled.").
-		Author("github.com/outlawlabs").
-		Version(fmt.Sprintf(versionTemplate, version, timestamp, commitHash))
+	return nil
+}
+
+// lockStore reads the AWS files in order to change them. It waits at most
+// --lock-timeout for other awsctl processes changing them, and holds their
+// lock until the store is unlocked. Where files cannot be locked, the AWS
+// files are read without a lock.
+func (g *globalOptions) lockStore() (*aws.Store, error) {
+	store, err := aws.LockStore(g.configFile, g.credentialsFile, g.lockTimeout)
+	if err == aws.ErrLockUnsupported {
+		logger.Debug("Changing the AWS files without a lock: %s.", err)
+		return aws.OpenStore(g.configFile, g.credentialsFile)
+	}
+	return store, err
+}
+
+// session returns the current credentials of the profile's MFA session.
+// The AWS files are read again every time, so sessions created by
+// "awsctl auth" in another terminal are picked up.
+func (g *globalOptions) session(profile string) (aws.Profile, error) {
+	store, err := aws.OpenStore(g.configFile, g.credentialsFile)
+	if err != nil {
+		return aws.Profile{}, err
+	}
+	if !store.HasProfile(profile) {
+		return aws.Profile{}, aws.ProfileNotFoundError(profile)
+	}
+
+	sessionProfile, err := store.SessionProfile(profile, g.sessionTemplates)
+	if err != nil {
+		return aws.Profile{}, err
+	}
+
+	session, err := store.Profile(sessionProfile)
+	if err != nil {
+		return aws.Profile{}, err
+	}
+	if session.SessionToken == "" {
+		return aws.Profile{}, errors.Errorf("no MFA session for profile %s, run awsctl auth --profile %s", profile, profile)
+	}
+	return session, nil
+}
 
-	configureAuthCommand(app, configFile, credentialsFile)
-	configureListCommand(app, configFile, credentialsFile)
-	configureNewCommand(app, configFile, credentialsFile)
-	configureRemoveCommand(app, configFile, credentialsFile)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+// activeSession returns the MFA session of the base profile, which must not
+// have expired.
+func (g *globalOptions) activeSession(base string) (aws.Profile, error) {
+	session, err := g.session(base)
+	if err != nil {
+		return aws.Profile{}, err
+	}
+	if expiration, ok := session.SessionExpiration(); ok && !time.Now().Before(expiration) {
+		return aws.Profile{}, &aws.Error{
+			Kind: aws.ErrorExpiredSession,
+			Err:  errors.Errorf("the MFA session of profile %s has expired, run awsctl auth --profile %s", base, base),
+		}
+	}
+	return session, nil
+}
+
+// roleCredentials assumes the role of the role profile with the MFA session,
+// or else the keys, of its source_profile. The role assumption is recorded in
+// the audit log.
+func (g *globalOptions) roleCredentials(store *aws.Store, p aws.Profile, config aws.STSConfig) (aws.Profile, error) {
+	if p.SourceProfile == "" {
+		return aws.Profile{}, errors.Errorf("role profile %s has no source_profile", p.Name)
+	}
+	source, err := store.Profile(p.SourceProfile)
+	if err != nil {
+		return aws.Profile{}, err
+	}
+	if source.IsRole() {
+		return aws.Profile{}, errors.Errorf("source_profile %s of profile %s is a role itself, which is not supported", source.Name, p.Name)
+	}
+	mfaSerial := source.MFASerial
+	if mfaSerial != "" {
+		if source, err = g.activeSession(source.Name); err != nil {
+			return aws.Profile{}, err
+		}
+	}
+
+	logger.Debug("Assuming role %s of profile: %s.", p.RoleARN, p.Name)
+	creds, arn, err := aws.AssumeRole(config, p, source)
+
+	record := audit.Record{
+		Profile:           p.Name,
+		Operation:         audit.OperationAssume,
+		CallerARN:         arn,
+		MFASerial:         mfaSerial,
+		RequestedDuration: p.DurationSeconds,
+		ErrorClass:        audit.ErrorClass(err),
+	}
+	if expiration, ok := creds.SessionExpiration(); ok {
+		record.GrantedDuration = int64(time.Until(expiration).Round(time.Second) / time.Second)
+	}
+	g.record(record)
+	return creds, err
+}
+
+// signingCredentials returns the credentials to sign requests of the profile
+// with: a session of the role of role profiles, the MFA session of profiles
+// with an MFA device, or else the profile's own keys.
+func (g *globalOptions) signingCredentials(store *aws.Store, p aws.Profile, config aws.STSConfig) (aws.Profile, error) {
+	switch {
+	case p.IsRole():
+		return g.roleCredentials(store, p, config)
+	case p.MFASerial != "":
+		return g.activeSession(p.Name)
+	case p.AccessKeyID == "" || p.SecretAccessKey == "":
+		return aws.Profile{}, errors.Errorf("profile %s has no credentials to sign requests with", p.Name)
+	}
+	return p, nil
+}
+
+// profileRegion returns the region to use for the profile: the given one, or
+// else the profile's region, or else the region of the source_profile of a
+// role profile.
+func profileRegion(store *aws.Store, p aws.Profile, region string) (string, error) {
+	if region == "" {
+		region = p.Region
+	}
+	if region == "" && p.IsRole() {
+		if source, err := store.Profile(p.SourceProfile); err == nil {
+			region = source.Region
+		}
+	}
+	if region == "" {
+		return "", errors.Errorf("region needs to be configured for the profile %s, or use --region", p.Name)
+	}
+	return region, nil
+}
+
+// stsConfig returns how to reach STS in the region with the settings of the
+// profile. A custom endpoint, e.g. of the --sts-endpoint flag, and the
+// AWS_STS_REGIONAL_ENDPOINTS environment variable take precedence over the
+// profile's own settings.
+func stsConfig(p aws.Profile, region, endpoint string) aws.STSConfig {
+	config := aws.STSConfig{
+		Region:            region,
+		RegionalEndpoints: p.STSRegionalEndpoints,
+		EndpointURL:       p.STSEndpointURL,
+	}
+	if value := os.Getenv("AWS_STS_REGIONAL_ENDPOINTS"); value != "" {
+		config.RegionalEndpoints = value
+	}
+	if endpoint != "" {
+		config.EndpointURL = endpoint
+	}
+	return config
 }
 
 // askForConfirmation asks the user for confirmation. This will not return until
@@ -108,11 +488,11 @@ func askForConfirmation(s string) bool {
 	reader := bufio.NewReader(os.Stdin)
 
 	for {
-		logger.Ask(fmt.Sprintf("%s [y/n]: ", s))
+		logger.Ask("%s [y/n]: ", s)
 
 		response, err := reader.ReadString('\n')
 		if err != nil {
-			logger.Critical(err.Error())
+			logger.Critical("%s", err)
 			os.Exit(1)
 		}
 
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestLoadSettingsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	settingsFile := filepath.Join(dir, "settings")
+	if err = ioutil.WriteFile(settingsFile, []byte("[global]\noutput = yaml\nsession_template = {{.Name\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		err  bool
+	}{
+		{[]string{"list"}, true},
+		{[]string{"config", "set", "output", "json"}, false},
+		{[]string{"config", "list"}, false},
+		{[]string{"completion", "bash"}, false},
+		{[]string{"--completion-bash", "list"}, false},
+	}
+
+	for _, test := range tests {
+		app := kingpin.New("awsctl", "")
+		g := &globalOptions{settingsFile: settingsFile}
+		configureCompletionCommand(app)
+		configureConfigCommand(app, g)
+		configureListCommand(app, g)
+
+		c, err := app.ParseContext(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.loadSettings(c)
+		if (err != nil) != test.err {
+			t.Errorf("%v: loadSettings() = %v, want error %v", test.args, err, test.err)
+			continue
+		}
+		if err == nil && (g.output != outputTable || g.sessionTemplates.Global != "") {
+			t.Errorf("%v: invalid settings were applied: output %q, template %q", test.args, g.output, g.sessionTemplates.Global)
+		}
+	}
+}
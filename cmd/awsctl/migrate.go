@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// migrateCommand represents all of the context for the "migrate" command.
+type migrateCommand struct {
+	dryRun bool
+	*globalOptions
+}
+
+// run will execute the functionality for the "migrate" command.
+func (m *migrateCommand) run(c *kingpin.ParseContext) error {
+
+	if m.configFile == "" {
+		return fmt.Errorf("~/.aws/config file error")
+	}
+
+	if m.credentialsFile == "" {
+		return fmt.Errorf("~/.aws/credentials file error")
+	}
+
+	store, err := m.lockStore()
+	if err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	renames, err := store.MigrateSessions(m.sessionTemplates)
+	if err != nil {
+		return err
+	}
+
+	if len(renames) <= 0 {
+		logger.Info("All session profiles already match their naming template.")
+		return nil
+	}
+
+	for _, r := range renames {
+		if r.To == "" {
+			logger.Info("Session profile of %s: %s is removed, another session is fresher", r.Base, r.From)
+			continue
+		}
+		logger.Info("Session profile of %s: %s -> %s", r.Base, r.From, r.To)
+	}
+
+	if m.dryRun {
+		logger.Warning("Dry run, nothing was saved.")
+		return nil
+	}
+
+	if err = store.Save(); err != nil {
+		return err
+	}
+
+	logger.Success("Successfully migrated %d session profile(s).", len(renames))
+	return nil
+}
+
+// configureMigrateCommand sets up the "migrate" command for the main
+// kingpin.Application.
+func configureMigrateCommand(app *kingpin.Application, g *globalOptions) {
+	m := &migrateCommand{
+		globalOptions: g,
+	}
+	migrate := app.Command("migrate", "Rename session profiles to match their naming template.").Action(m.run)
+	migrate.Flag("dry-run", "Only print the session profiles that would be renamed.").BoolVar(&m.dryRun)
+}
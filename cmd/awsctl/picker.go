@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+)
+
+// pickerHeight is the maximum number of items the picker shows at once.
+const pickerHeight = 10
+
+// errPickerCanceled is returned when the picker is left without choosing an
+// item.
+var errPickerCanceled = errors.New("no profile selected")
+
+// pickerItem is a single choice of the interactive picker.
+type pickerItem struct {
+	name   string
+	detail string
+}
+
+// interactive reports whether awsctl can prompt the user, i.e. whether stdin
+// is a terminal.
+func interactive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd())
+}
+
+// canPick reports whether awsctl can show the interactive picker, which
+// additionally needs raw mode of the terminal.
+func canPick() bool {
+	return rawModeSupported && interactive()
+}
+
+// fuzzyMatch reports whether every character of query appears in s in order,
+// ignoring case.
+func fuzzyMatch(s, query string) bool {
+	s, query = strings.ToLower(s), strings.ToLower(query)
+	for _, r := range query {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
+
+// picker lets the user choose one item from a list by moving through it with
+// the arrow keys and typing to filter it.
+type picker struct {
+	prompt   string
+	items    []pickerItem
+	query    string
+	matches  []pickerItem
+	selected int
+	drawn    int
+}
+
+// filter updates the matching items for the current query.
+func (p *picker) filter() {
+	p.matches = p.matches[:0]
+	for _, item := range p.items {
+		if fuzzyMatch(item.name, p.query) {
+			p.matches = append(p.matches, item)
+		}
+	}
+	if p.selected >= len(p.matches) {
+		p.selected = len(p.matches) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+// move changes the selected item by delta, wrapping around at either end.
+func (p *picker) move(delta int) {
+	if len(p.matches) == 0 {
+		return
+	}
+	p.selected = (p.selected + delta + len(p.matches)) % len(p.matches)
+}
+
+// render draws the picker to stderr, replacing what was drawn before. The
+// terminal is in raw mode, so lines end in "\r\n".
+func (p *picker) render() {
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", p.drawn)
+	}
+	b.WriteString("\r\x1b[J")
+
+	// Keep the selected item within the visible window.
+	start := 0
+	if p.selected >= pickerHeight {
+		start = p.selected - pickerHeight + 1
+	}
+	end := start + pickerHeight
+	if end > len(p.matches) {
+		end = len(p.matches)
+	}
+
+	width := 0
+	for _, item := range p.matches[start:end] {
+		if len(item.name) > width {
+			width = len(item.name)
+		}
+	}
+
+	lines := 0
+	for i := start; i < end; i++ {
+		item := p.matches[i]
+		line := fmt.Sprintf("%-*s  %s", width, item.name, item.detail)
+		if i == p.selected {
+			fmt.Fprintf(&b, "\x1b[7m> %s\x1b[0m\r\n", line)
+		} else {
+			fmt.Fprintf(&b, "  %s\r\n", line)
+		}
+		lines++
+	}
+	if len(p.matches) == 0 {
+		b.WriteString("  (no matching profiles)\r\n")
+		lines++
+	}
+	fmt.Fprintf(&b, "%d/%d %s %s", len(p.matches), len(p.items), p.prompt, p.query)
+
+	p.drawn = lines
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+// clear removes the picker from the terminal.
+func (p *picker) clear() {
+	if p.drawn > 0 {
+		fmt.Fprintf(os.Stderr, "\x1b[%dA", p.drawn)
+	}
+	fmt.Fprint(os.Stderr, "\r\x1b[J")
+}
+
+// pick shows an interactive picker for items and returns the name of the
+// chosen item. It returns errPickerCanceled if the user leaves the picker with
+// Esc or Ctrl-C.
+func pick(prompt string, items []pickerItem) (string, error) {
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	p := &picker{prompt: prompt, items: items}
+	p.filter()
+	p.render()
+	defer p.clear()
+
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read from terminal")
+		}
+
+		for _, key := range splitKeys(buf[:n]) {
+			switch key {
+			case "\r", "\n":
+				if len(p.matches) == 0 {
+					continue
+				}
+				return p.matches[p.selected].name, nil
+			case "\x03", "\x1b":
+				return "", errPickerCanceled
+			case "\x1b[A", "\x1bOA", "\x10":
+				p.move(-1)
+			case "\x1b[B", "\x1bOB", "\x0e":
+				p.move(1)
+			case "\x7f", "\x08":
+				if q := []rune(p.query); len(q) > 0 {
+					p.query = string(q[:len(q)-1])
+				}
+				p.filter()
+			case "\x15":
+				p.query = ""
+				p.filter()
+			default:
+				// Ignore any other control characters and escape sequences.
+				if key[0] < 0x20 || key[0] == 0x7f {
+					continue
+				}
+				p.query += key
+				p.selected = 0
+				p.filter()
+			}
+		}
+		p.render()
+	}
+}
+
+// splitKeys splits the bytes read from the terminal into single key presses:
+// characters and escape sequences such as those of the arrow keys.
+func splitKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		n := 1
+		switch {
+		case b[0] == 0x1b && len(b) > 1 && (b[1] == '[' || b[1] == 'O'):
+			// CSI and SS3 sequences end with a byte in the range 0x40-0x7e.
+			n = 2
+			for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+				n++
+			}
+			if n < len(b) {
+				n++
+			}
+		case b[0] >= utf8.RuneSelf:
+			_, n = utf8.DecodeRune(b)
+		}
+		keys = append(keys, string(b[:n]))
+		b = b[n:]
+	}
+	return keys
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		s     string
+		query string
+		want  bool
+	}{
+		{"cowboy", "", true},
+		{"cowboy", "cowboy", true},
+		{"cowboy", "cwb", true},
+		{"cowboy", "CWB", true},
+		{"Prod-Admin", "padm", true},
+		{"cowboy", "bc", false},
+		{"cowboy", "cowboys", false},
+		{"cowboy", "x", false},
+		{"ÿber-dev", "ÿd", true},
+		{"", "a", false},
+	}
+
+	for _, test := range tests {
+		if got := fuzzyMatch(test.s, test.query); got != test.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", test.s, test.query, got, test.want)
+		}
+	}
+}
+
+func TestPickerFilter(t *testing.T) {
+	p := &picker{items: []pickerItem{{name: "dev-a"}, {name: "dev-b"}, {name: "prod"}}}
+
+	tests := []struct {
+		query    string
+		selected int
+		want     []string
+		wantSel  int
+	}{
+		{"", 0, []string{"dev-a", "dev-b", "prod"}, 0},
+		{"dv", 2, []string{"dev-a", "dev-b"}, 1},
+		{"pd", 1, []string{"prod"}, 0},
+		{"zz", 0, nil, 0},
+	}
+
+	for _, test := range tests {
+		p.query, p.selected = test.query, test.selected
+		p.filter()
+		var names []string
+		for _, item := range p.matches {
+			names = append(names, item.name)
+		}
+		if !reflect.DeepEqual(names, test.want) || p.selected != test.wantSel {
+			t.Errorf("filter(%q) = %v, selected %d, want %v, selected %d", test.query, names, p.selected, test.want, test.wantSel)
+		}
+	}
+
+	p.query = ""
+	p.filter()
+	p.selected = 0
+	for _, want := range []int{2, 1} {
+		p.move(-1)
+		if p.selected != want {
+			t.Errorf("move(-1) selected %d, want %d", p.selected, want)
+		}
+	}
+	p.move(2)
+	if p.selected != 0 {
+		t.Errorf("move(2) selected %d, want it to wrap to 0", p.selected)
+	}
+}
@@ -2,23 +2,26 @@ package main
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/outlawlabs/awsctl/pkg/logger"
 	"github.com/pkg/errors"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
-	ini "gopkg.in/ini.v1"
 
+	"github.com/outlawlabs/awsctl/pkg/audit"
 	"github.com/outlawlabs/awsctl/pkg/aws"
 )
 
 // removeCommand represents all of the context for the "remove" command.
 type removeCommand struct {
-	profile         string
-	configFile      string
-	credentialsFile string
+	profiles []string
+	yes      bool
+	cascade  bool
+	*globalOptions
 }
 
-// run will execute the functionality for the "new" command.
+// run will execute the functionality for the "remove" command.
 func (r *removeCommand) run(c *kingpin.ParseContext) error {
 
 	if r.configFile == "" {
@@ -29,46 +32,83 @@ func (r *removeCommand) run(c *kingpin.ParseContext) error {
 		return errors.New("~/.aws/credentials file error")
 	}
 
-	credentials, err := ini.Load(r.credentialsFile)
+	store, err := aws.OpenStore(r.configFile, r.credentialsFile)
 	if err != nil {
-		return errors.Wrap(err, "failed to read credentials file")
+		return err
 	}
 
-	config, err := ini.Load(r.configFile)
+	profiles, err := store.MatchProfiles(r.profiles)
 	if err != nil {
-		return errors.Wrap(err, "failed to read config file")
+		return errors.Wrap(err, "cannot remove profile")
 	}
 
-	// Create the template for the new AWS CLI profile.
-	configProfile := fmt.Sprintf("profile %s", r.profile)
+	removals, err := aws.PlanRemoval(profiles, r.cascade, store)
+	if err != nil {
+		return errors.Wrap(err, "cannot remove profile")
+	}
 
-	// Ignore error -- *should* only come back as not found if the section does
-	// not exist already.
-	if _, err = config.GetSection(configProfile); err != nil {
-		return errors.New("cannot remove profile, it does not exist")
+	logger.Info("The following profiles will be removed:")
+	for _, removal := range removals {
+		description := removal.Profile
+		if len(removal.Sessions) > 0 {
+			description = fmt.Sprintf("%s (sessions: %s)", description, strings.Join(removal.Sessions, ", "))
+		}
+		if removal.DependencyOf != "" {
+			description = fmt.Sprintf("%s (source_profile: %s)", description, removal.DependencyOf)
+		}
+		// Keep the plan on standard error together with its header.
+		logger.Log("  - %s", description, logger.Default.Err)
 	}
 
-	confirm := askForConfirmation(fmt.Sprintf("Are you sure you want to remove your profile: %s", r.profile))
-	if !confirm {
-		logger.Info("Cancelled removal.")
-		return nil
+	if !r.yes {
+		confirm := askForConfirmation(fmt.Sprintf("Are you sure you want to remove %d profile(s)", len(removals)))
+		if !confirm {
+			logger.Info("Cancelled removal.")
+			return nil
+		}
 	}
 
-	if err = aws.RemoveProfile(configProfile, config, credentials, r.configFile, r.credentialsFile); err != nil {
+	// Only lock the AWS files now, so other awsctl processes do not have to
+	// wait for the confirmation, and plan the removal again. Never remove
+	// anything but what was confirmed.
+	if store, err = r.lockStore(); err != nil {
 		return err
 	}
+	defer store.Unlock()
+	confirmed := removals
+	if removals, err = aws.PlanRemoval(profiles, r.cascade, store); err != nil {
+		return errors.Wrap(err, "cannot remove profile")
+	}
+	if !reflect.DeepEqual(removals, confirmed) {
+		return errors.New("cannot remove profile: the AWS files changed while waiting for confirmation, please try again")
+	}
 
-	logger.Success("Successfully removed config and credentials for profile: %s.", r.profile)
+	err = aws.RemoveProfiles(removals, store)
+	for _, removal := range removals {
+		r.record(audit.Record{
+			Profile:    removal.Profile,
+			Operation:  audit.OperationRemove,
+			ErrorClass: audit.ErrorClass(err),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, removal := range removals {
+		logger.Success("Successfully removed config and credentials for profile: %s.", removal.Profile)
+	}
 	return nil
 }
 
 // configureRemoveCommand sets up the "remove" command for the main
 // kingpin.Application.
-func configureRemoveCommand(app *kingpin.Application, configFile, credentialsFile string) {
+func configureRemoveCommand(app *kingpin.Application, g *globalOptions) {
 	r := &removeCommand{
-		configFile:      configFile,
-		credentialsFile: credentialsFile,
+		globalOptions: g,
 	}
-	remove := app.Command("remove", "Remove an existing AWS profile & credential pair.").Action(r.run)
-	remove.Arg("profile", "AWS profile to remove.").Required().StringVar(&r.profile)
+	remove := app.Command("remove", "Remove existing AWS profiles & credential pairs, including their MFA sessions.").Action(r.run)
+	remove.Arg("profiles", "AWS profiles or glob patterns, e.g. dev-*, to remove.").Required().HintAction(g.profileHints).StringsVar(&r.profiles)
+	remove.Flag("yes", "Do not ask for confirmation.").Short('y').BoolVar(&r.yes)
+	remove.Flag("cascade", "Also remove role profiles that use a removed profile as their source_profile.").BoolVar(&r.cascade)
 }
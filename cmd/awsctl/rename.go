@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// renameCommand represents all of the context for the "rename" command.
+type renameCommand struct {
+	oldProfile string
+	newProfile string
+	*globalOptions
+}
+
+// run will execute the functionality for the "rename" command.
+func (r *renameCommand) run(c *kingpin.ParseContext) error {
+
+	if r.configFile == "" {
+		return errors.New("~/.aws/config file error")
+	}
+
+	if r.credentialsFile == "" {
+		return errors.New("~/.aws/credentials file error")
+	}
+
+	store, err := r.lockStore()
+	if err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	updated, removed, err := aws.RenameProfile(r.oldProfile, r.newProfile, r.sessionTemplates, store)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range removed {
+		logger.Info("Removed session profile: %s, another session is fresher.", name)
+	}
+	for _, name := range updated {
+		logger.Info("Updated source_profile of profile: %s.", name)
+	}
+	logger.Success("Successfully renamed profile %s to %s.", r.oldProfile, r.newProfile)
+	return nil
+}
+
+// configureRenameCommand sets up the "rename" command for the main
+// kingpin.Application.
+func configureRenameCommand(app *kingpin.Application, g *globalOptions) {
+	r := &renameCommand{
+		globalOptions: g,
+	}
+	rename := app.Command("rename", "Rename an existing AWS profile together with its MFA sessions.").Action(r.run)
+	rename.Arg("old", "AWS profile to rename.").Required().HintAction(g.profileHints).StringVar(&r.oldProfile)
+	rename.Arg("new", "New name of the AWS profile.").Required().StringVar(&r.newProfile)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+	"github.com/outlawlabs/awsctl/pkg/server"
+)
+
+const (
+	// refreshWindow is how long before its expiration a session is refreshed.
+	refreshWindow = 5 * time.Minute
+	// refreshInterval is how often the session is checked.
+	refreshInterval = 30 * time.Second
+)
+
+// serveCommand represents all of the context for the "serve" command.
+type serveCommand struct {
+	profile     string
+	listen      string
+	token       string
+	imds        bool
+	stsEndpoint string
+	*globalOptions
+}
+
+// refresh keeps the session of the profile alive. Shortly before the session
+// expires it asks for a new MFA token on the terminal; without a terminal it
+// can only warn, and the session has to be refreshed with "awsctl auth".
+func (s *serveCommand) refresh(ctx context.Context) {
+	scanner := bufio.NewScanner(os.Stdin)
+	warned := false
+
+	for {
+		session, err := s.session(s.profile)
+		expiration, ok := session.SessionExpiration()
+		if err == nil && (!ok || time.Until(expiration) > refreshWindow) {
+			warned = false
+		} else if !interactive() {
+			if !warned {
+				logger.Warning("The MFA session of profile %s needs to be refreshed: awsctl auth --profile %s", s.profile, s.profile)
+				warned = true
+			}
+		} else {
+			logger.Ask("Enter a MFA token to refresh the session of profile %s:", s.profile)
+			if !scanner.Scan() {
+				return
+			}
+			if err = s.authenticate(strings.TrimSpace(scanner.Text())); err != nil {
+				logger.Critical("%s", err)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(refreshInterval):
+		}
+	}
+}
+
+// authenticate creates a new session for the profile, just like "awsctl auth".
+func (s *serveCommand) authenticate(token string) error {
+	return s.refreshSession(s.profile, s.stsEndpoint, token)
+}
+
+// run will execute the functionality for the "serve" command.
+func (s *serveCommand) run(c *kingpin.ParseContext) error {
+
+	store, err := aws.OpenStore(s.configFile, s.credentialsFile)
+	if err != nil {
+		return err
+	}
+	if !store.HasProfile(s.profile) {
+		return aws.ProfileNotFoundError(s.profile)
+	}
+	if !store.Config.Section(aws.ConfigSection(s.profile)).HasKey(keyMFASerial) {
+		return fmt.Errorf("mfa_serial needs to bet configured for the profile: %s", s.profile)
+	}
+
+	if s.imds {
+		if err = server.CheckIMDSAddress(s.listen); err != nil {
+			return err
+		}
+	}
+
+	if s.token == "" {
+		if s.token, err = server.NewToken(); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", s.listen)
+	}
+
+	srv := &http.Server{
+		Handler: &server.Server{
+			Name:        s.profile,
+			Token:       s.token,
+			IMDS:        s.imds,
+			Credentials: func() (aws.Profile, error) { return s.session(s.profile) },
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	address := listener.Addr().String()
+	logger.Info("Serving credentials of profile %s on %s.", s.profile, address)
+	logger.Always("export AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s%s", address, server.CredentialsPath)
+	logger.Always("export AWS_CONTAINER_AUTHORIZATION_TOKEN=%s", s.token)
+	if s.imds {
+		logger.Always("export AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s/", address)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.refresh(ctx)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(listener)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err = <-errs:
+		return errors.Wrap(err, "failed to serve credentials")
+	case <-signals:
+	}
+
+	logger.Info("Shutting down.")
+	shutdown, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	return srv.Shutdown(shutdown)
+}
+
+// configureServeCommand sets up the "serve" command for the main
+// kingpin.Application.
+func configureServeCommand(app *kingpin.Application, g *globalOptions) {
+	s := &serveCommand{
+		globalOptions: g,
+	}
+	serve := app.Command("serve", "Serve MFA session credentials over the ECS container credentials endpoint.").Action(s.run)
+	serve.Flag("profile", "AWS profile to serve the MFA session of.").Short('p').Required().HintAction(g.profileHints).StringVar(&s.profile)
+	serve.Flag("listen", "Address to listen on.").Default("127.0.0.1:9911").StringVar(&s.listen)
+	serve.Flag("token", "Authorization token of the ECS endpoint, random by default.").Envar("AWSCTL_SERVE_TOKEN").StringVar(&s.token)
+	serve.Flag("sts-endpoint", "Custom STS endpoint URL.").Envar("AWS_ENDPOINT_URL_STS").StringVar(&s.stsEndpoint)
+	serve.Flag("imds", "Also serve an IMDSv2 compatible instance metadata endpoint, only on a loopback or link-local address.").BoolVar(&s.imds)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+const (
+	sessionNone    = "none"
+	sessionActive  = "active"
+	sessionExpired = "expired"
+)
+
+// statusCommand represents all of the context for the "status" command.
+type statusCommand struct {
+	profile string
+	*globalOptions
+}
+
+// sessionState returns the state of the session profile and its expiration, if
+// one is known.
+func sessionState(store *aws.Store, session string) (string, string) {
+	p, err := store.Profile(session)
+	if err != nil || p.SessionToken == "" {
+		return sessionNone, ""
+	}
+	if p.AuthenticationExpiration == "" {
+		return sessionActive, ""
+	}
+
+	expiration, ok := p.SessionExpiration()
+	if !ok || !time.Now().Before(expiration) {
+		return sessionExpired, p.AuthenticationExpiration
+	}
+	return sessionActive, p.AuthenticationExpiration
+}
+
+// run will execute the functionality for the "status" command.
+func (s *statusCommand) run(c *kingpin.ParseContext) error {
+
+	if s.configFile == "" {
+		return fmt.Errorf("~/.aws/config file error")
+	}
+
+	if s.credentialsFile == "" {
+		return fmt.Errorf("~/.aws/credentials file error")
+	}
+
+	store, err := aws.OpenStore(s.configFile, s.credentialsFile)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := store.Profiles()
+	if err != nil {
+		return err
+	}
+
+	sessions := store.Sessions()
+	headers := []string{"Profile", "Session Profile", "State", "Expiration"}
+	var data [][]string
+	for _, p := range profiles {
+		// Only base profiles with an MFA device have sessions.
+		if _, ok := sessions[p.Name]; ok || p.MFASerial == "" {
+			continue
+		}
+		if s.profile != "" && p.Name != s.profile {
+			continue
+		}
+
+		session, err := store.SessionProfile(p.Name, s.sessionTemplates)
+		if err != nil {
+			return err
+		}
+		state, expiration := sessionState(store, session)
+		data = append(data, []string{p.Name, session, state, expiration})
+	}
+
+	if len(data) <= 0 {
+		logger.Warning("Could not find any MFA profiles. See %s for help.", awsCLIHelp)
+	}
+
+	return s.printTable(headers, data)
+}
+
+// configureStatusCommand sets up the "status" command for the main
+// kingpin.Application.
+func configureStatusCommand(app *kingpin.Application, g *globalOptions) {
+	s := &statusCommand{
+		globalOptions: g,
+	}
+	status := app.Command("status", "Show the MFA session state of AWS profiles.").Action(s.run)
+	status.Arg("profile", "AWS profile to show.").HintAction(g.profileHints).StringVar(&s.profile)
+}
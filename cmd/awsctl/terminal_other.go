@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import "github.com/pkg/errors"
+
+// rawModeSupported reports whether makeRaw can put the terminal into raw mode.
+const rawModeSupported = false
+
+// makeRaw is not supported on this platform, so interactive prompts fall back
+// to their non-interactive behavior.
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.New("interactive terminal mode is not supported on this platform")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/outlawlabs/awsctl/pkg/audit"
+	"github.com/outlawlabs/awsctl/pkg/aws"
+	"github.com/outlawlabs/awsctl/pkg/logger"
+)
+
+// updateCommand represents all of the context for the "update" command.
+type updateCommand struct {
+	profile            string
+	region             string
+	mfaSerial          string
+	rotateKeys         bool
+	sessionDuration    string
+	allowUnknownRegion bool
+	*globalOptions
+}
+
+// run will execute the functionality for the "update" command.
+func (u *updateCommand) run(c *kingpin.ParseContext) error {
+
+	if u.configFile == "" {
+		return errors.New("~/.aws/config file error")
+	}
+
+	if u.credentialsFile == "" {
+		return errors.New("~/.aws/credentials file error")
+	}
+
+	// Ask for new keys before taking the lock of the AWS files, so other
+	// awsctl processes do not have to wait for the user.
+	var accessKeyID, secretAccessKey string
+	if u.rotateKeys {
+		scanner := bufio.NewScanner(os.Stdin)
+		logger.Ask("Enter your new access key ID:")
+		scanner.Scan()
+		accessKeyID = scanner.Text()
+
+		logger.Ask("Enter your new secret access key:")
+		scanner.Scan()
+		secretAccessKey = scanner.Text()
+
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err, "failed to read new keys")
+		}
+	}
+
+	store, err := u.lockStore()
+	if err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	if !store.HasProfile(u.profile) {
+		return errors.Wrap(aws.ProfileNotFoundError(u.profile), "cannot update profile")
+	}
+
+	current, err := store.Profile(u.profile)
+	if err != nil {
+		return err
+	}
+
+	if current.IsRole() {
+		return u.updateRole(store, current)
+	}
+
+	// A zero duration removes the profile's own session duration.
+	var duration time.Duration
+	if u.sessionDuration != "" {
+		if duration, err = aws.ParseDuration(u.sessionDuration); err != nil {
+			return err
+		}
+		if duration != 0 {
+			if err = aws.GetSessionTokenLimits.Validate(duration); err != nil {
+				return err
+			}
+		}
+	}
+	// An invalid current duration is simply replaced.
+	currentDuration, _, _ := store.SessionDuration(u.profile)
+	durationChanged := u.sessionDuration != "" && duration != currentDuration
+
+	updated := current
+	if u.region != "" {
+		updated.Region = u.region
+	}
+	if u.mfaSerial != "" {
+		updated.MFASerial = u.mfaSerial
+	}
+	if u.rotateKeys {
+		updated.AccessKeyID = accessKeyID
+		updated.SecretAccessKey = secretAccessKey
+	}
+
+	// Apply the same rules a new profile has to follow, but only look up a
+	// region that changed, so a region that was once allowed keeps working.
+	if err = updated.Validate(); err != nil {
+		return err
+	}
+	if updated.Region != current.Region {
+		if _, err = aws.LookupRegion(updated.Region, u.allowUnknownRegion); err != nil {
+			return err
+		}
+	}
+
+	identityChanged := updated.MFASerial != current.MFASerial ||
+		updated.AccessKeyID != current.AccessKeyID ||
+		updated.SecretAccessKey != current.SecretAccessKey
+	if !identityChanged && !durationChanged && updated.Region == current.Region {
+		logger.Info("Nothing to update for profile: %s.", u.profile)
+		return nil
+	}
+
+	if identityChanged {
+		for _, session := range store.InvalidateSessions(u.profile) {
+			logger.Info("Invalidated MFA session profile: %s.", session)
+		}
+	}
+
+	// Record which settings changed, never their values.
+	var changes []string
+	if updated.Region != current.Region {
+		changes = append(changes, keyRegion)
+	}
+	if updated.MFASerial != current.MFASerial {
+		changes = append(changes, keyMFASerial)
+	}
+	if updated.AccessKeyID != current.AccessKeyID || updated.SecretAccessKey != current.SecretAccessKey {
+		changes = append(changes, keyAccessKeyID, keySecretAccessKey)
+	}
+	if durationChanged {
+		changes = append(changes, keySessionDuration)
+		if err = store.SetSessionDuration(u.profile, duration); err != nil {
+			return err
+		}
+	}
+
+	// Update writes the base profile first and then syncs the settings of its
+	// session profiles, e.g. a new region.
+	err = updated.Update(store)
+	u.record(audit.Record{
+		Profile:    u.profile,
+		Operation:  audit.OperationUpdate,
+		MFASerial:  updated.MFASerial,
+		Changes:    changes,
+		ErrorClass: audit.ErrorClass(err),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Success("Successfully updated config and credentials for profile: %s.", u.profile)
+	if identityChanged {
+		logger.Always("Create a new MFA session: awsctl auth --profile %s", u.profile)
+	}
+	return nil
+}
+
+// updateRole updates a role profile, of which only the session duration is
+// managed by awsctl. It is stored as duration_seconds and must be within the
+// limits of AssumeRole.
+func (u *updateCommand) updateRole(store *aws.Store, current aws.Profile) error {
+	if u.region != "" || u.mfaSerial != "" || u.rotateKeys || u.sessionDuration == "" {
+		return errors.Errorf("only --session-duration can be updated for role profile: %s", u.profile)
+	}
+
+	duration, err := aws.ParseDuration(u.sessionDuration)
+	if err != nil {
+		return err
+	}
+	if duration != 0 {
+		if err = store.RoleSessionLimits(current).Validate(duration); err != nil {
+			return err
+		}
+		logger.Warning("The role's own maximum session duration, 1h unless raised on the role, may be lower.")
+	}
+
+	err = store.SetRoleSessionDuration(u.profile, duration)
+	if err == nil {
+		err = store.Save()
+	}
+	u.record(audit.Record{
+		Profile:    u.profile,
+		Operation:  audit.OperationUpdate,
+		Changes:    []string{keyDurationSeconds},
+		ErrorClass: audit.ErrorClass(err),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Success("Successfully updated config for profile: %s.", u.profile)
+	return nil
+}
+
+// configureUpdateCommand sets up the "update" command for the main
+// kingpin.Application.
+func configureUpdateCommand(app *kingpin.Application, g *globalOptions) {
+	u := &updateCommand{
+		globalOptions: g,
+	}
+	update := app.Command("update", "Update an existing AWS profile & credential pair.").Action(u.run)
+	update.Arg("profile", "AWS profile to update.").Required().HintAction(g.profileHints).StringVar(&u.profile)
+	update.Flag("region", "New AWS region.").HintAction(regionHints).StringVar(&u.region)
+	update.Flag("mfa-serial", "New MFA device serial number.").StringVar(&u.mfaSerial)
+	update.Flag("rotate-keys-from-stdin", "Read a new access key ID and secret access key from standard input.").BoolVar(&u.rotateKeys)
+	update.Flag("session-duration", "Duration of MFA sessions, e.g. 12h or 90m, 0 removes it.").StringVar(&u.sessionDuration)
+	update.Flag("allow-unknown-region", "Accept regions that are not known to awsctl yet.").BoolVar(&u.allowUnknownRegion)
+}
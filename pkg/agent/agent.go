@@ -0,0 +1,453 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+// Operations the agent answers.
+const (
+	OpAuth        = "auth"
+	OpCredentials = "credentials"
+	OpStatus      = "status"
+	OpStop        = "stop"
+)
+
+// defaultInterval is how often the agent checks for expiring sessions and
+// whether it is idle.
+const defaultInterval = 30 * time.Second
+
+// errStopping answers requests that arrive while the agent stops.
+var errStopping = errors.New("the agent is stopping")
+
+// Request is a single request to the agent. Requests and responses are sent
+// as one JSON object per line.
+type Request struct {
+	Op      string `json:"op"`
+	Profile string `json:"profile,omitempty"`
+	// Token is the MFA token of an auth request.
+	Token string `json:"token,omitempty"`
+}
+
+// Credentials are the session credentials of a profile.
+type Credentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	// Expiration is formatted as RFC 3339, it is empty if it is not known.
+	Expiration string `json:"expiration,omitempty"`
+}
+
+// Session is a session cached by the agent.
+type Session struct {
+	Profile    string `json:"profile"`
+	Expiration string `json:"expiration,omitempty"`
+}
+
+// Status describes a running agent.
+type Status struct {
+	PID         int       `json:"pid"`
+	Started     time.Time `json:"started"`
+	LastRequest time.Time `json:"last_request"`
+	// IdleTimeout is in seconds.
+	IdleTimeout int64     `json:"idle_timeout"`
+	Sessions    []Session `json:"sessions"`
+}
+
+// Response is the answer to a Request. Kind classifies Error, so callers can
+// exit with the same codes as without the agent.
+type Response struct {
+	Error       string        `json:"error,omitempty"`
+	Kind        aws.ErrorKind `json:"kind,omitempty"`
+	Credentials *Credentials  `json:"credentials,omitempty"`
+	Status      *Status       `json:"status,omitempty"`
+}
+
+// CredentialsFunc loads the current session credentials of a profile.
+type CredentialsFunc func(profile string) (aws.Profile, error)
+
+// AuthenticateFunc creates a new session for a profile with the MFA token.
+type AuthenticateFunc func(profile, token string) error
+
+// Agent caches session credentials in memory and answers requests for them
+// over a Unix socket. Sessions are loaded again shortly before they expire, so
+// a session refreshed by "awsctl auth" is picked up. An auth request refreshes
+// a session with an MFA token instead; concurrent auth requests for the same
+// profile share a single authentication, so an MFA token is never used twice.
+// The agent never caches long-term keys. Once no request was made for
+// IdleTimeout, the agent wipes its cache and stops.
+type Agent struct {
+	// Credentials loads the session credentials of a profile.
+	Credentials CredentialsFunc
+	// Authenticate creates a new session for a profile. Without it auth
+	// requests fail.
+	Authenticate AuthenticateFunc
+	// RefreshWindow is how long before their expiration sessions are loaded
+	// again.
+	RefreshWindow time.Duration
+	// IdleTimeout stops the agent when no request was made for so long. Zero
+	// disables it.
+	IdleTimeout time.Duration
+
+	// interval overrides defaultInterval.
+	interval time.Duration
+
+	mu          sync.Mutex
+	sessions    map[string]aws.Profile
+	flights     map[string]*flight
+	started     time.Time
+	lastRequest time.Time
+	listener    net.Listener
+	stopped     bool
+}
+
+// flight is a load or authentication in progress, which concurrent requests
+// for the same profile wait for instead of repeating it.
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+// DefaultSocket returns the location of the agent's socket, within
+// XDG_RUNTIME_DIR if it is set.
+func DefaultSocket() string {
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		return filepath.Join(runtime, "awsctl", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), "awsctl-"+strconv.Itoa(os.Getuid()), "agent.sock")
+}
+
+// Listen listens on the Unix socket, which only the current user may connect
+// to. A socket left behind by an agent that is gone is replaced.
+func Listen(socket string) (net.Listener, error) {
+	directory := filepath.Dir(socket)
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to make directory: %s", directory)
+	}
+	if err := os.Chmod(directory, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to restrict directory: %s", directory)
+	}
+
+	if _, err := os.Stat(socket); err == nil {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("an agent is already listening on %s", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, errors.Wrapf(err, "failed to remove stale socket: %s", socket)
+		}
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", socket)
+	}
+	if err = os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, errors.Wrapf(err, "failed to restrict socket: %s", socket)
+	}
+	return listener, nil
+}
+
+// Serve answers requests on the listener until the agent is stopped, either
+// by a stop request, by Stop or by the idle timeout.
+func (a *Agent) Serve(listener net.Listener) error {
+	a.mu.Lock()
+	a.listener = listener
+	a.sessions = map[string]aws.Profile{}
+	a.flights = map[string]*flight{}
+	a.started = time.Now()
+	a.lastRequest = a.started
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	go a.watch(done)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			a.mu.Lock()
+			stopped := a.stopped
+			a.mu.Unlock()
+			if stopped {
+				return nil
+			}
+			return errors.Wrap(err, "failed to accept connection")
+		}
+		go a.handle(conn)
+	}
+}
+
+// Stop wipes the cached sessions and stops serving.
+func (a *Agent) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stop()
+}
+
+// stop must be called with a.mu held.
+func (a *Agent) stop() {
+	if a.stopped {
+		return
+	}
+	a.stopped = true
+	for profile := range a.sessions {
+		delete(a.sessions, profile)
+	}
+	if a.listener != nil {
+		a.listener.Close()
+	}
+}
+
+// watch stops the agent once it was idle for too long, and loads sessions that
+// are about to expire again, so requests do not have to wait for it.
+func (a *Agent) watch(done chan struct{}) {
+	interval := a.interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		a.mu.Lock()
+		if a.IdleTimeout > 0 && time.Since(a.lastRequest) >= a.IdleTimeout {
+			a.stop()
+			a.mu.Unlock()
+			return
+		}
+		var expiring []string
+		for profile, session := range a.sessions {
+			if a.expiring(session) {
+				expiring = append(expiring, profile)
+			}
+		}
+		a.mu.Unlock()
+
+		for _, profile := range expiring {
+			a.load(profile)
+		}
+	}
+}
+
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	var request Request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&request); err != nil {
+		json.NewEncoder(conn).Encode(Response{Error: "invalid request: " + err.Error()})
+		return
+	}
+	json.NewEncoder(conn).Encode(a.answer(request))
+}
+
+func (a *Agent) answer(request Request) Response {
+	if request.Op == OpCredentials || request.Op == OpAuth {
+		session, err := a.session(request.Profile, request.Token, request.Op == OpAuth)
+		if err != nil {
+			return Response{Error: err.Error(), Kind: aws.KindOf(err)}
+		}
+		credentials := &Credentials{
+			AccessKeyID:     session.AccessKeyID,
+			SecretAccessKey: session.SecretAccessKey,
+			SessionToken:    session.SessionToken,
+		}
+		if expiration, ok := session.SessionExpiration(); ok {
+			credentials.Expiration = expiration.UTC().Format(time.RFC3339)
+		}
+		return Response{Credentials: credentials}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopped {
+		return Response{Error: errStopping.Error()}
+	}
+
+	switch request.Op {
+	case OpStatus:
+		status := &Status{
+			PID:         os.Getpid(),
+			Started:     a.started,
+			LastRequest: a.lastRequest,
+			IdleTimeout: int64(a.IdleTimeout / time.Second),
+			Sessions:    []Session{},
+		}
+		for profile, session := range a.sessions {
+			status.Sessions = append(status.Sessions, Session{Profile: profile, Expiration: session.AuthenticationExpiration})
+		}
+		sort.Slice(status.Sessions, func(i, j int) bool {
+			return status.Sessions[i].Profile < status.Sessions[j].Profile
+		})
+		return Response{Status: status}
+
+	case OpStop:
+		a.stop()
+		return Response{}
+	}
+	return Response{Error: "unknown operation: " + request.Op}
+}
+
+// session returns the cached session of the profile, loading it if it is not
+// cached or about to expire. With auth a new session is created with the MFA
+// token first.
+func (a *Agent) session(profile, token string, auth bool) (aws.Profile, error) {
+	if profile == "" {
+		return aws.Profile{}, errors.New("no profile requested")
+	}
+
+	a.mu.Lock()
+	if a.stopped {
+		a.mu.Unlock()
+		return aws.Profile{}, errStopping
+	}
+	// Only requests for credentials and auth requests keep the agent from
+	// idling.
+	a.lastRequest = time.Now()
+	session, ok := a.sessions[profile]
+	a.mu.Unlock()
+
+	if auth {
+		if a.Authenticate == nil {
+			return aws.Profile{}, errors.New("the agent cannot authenticate")
+		}
+		err := a.do(OpAuth+" "+profile, func() error {
+			if err := a.Authenticate(profile, token); err != nil {
+				return err
+			}
+			return a.fetch(profile)
+		})
+		if err != nil {
+			return aws.Profile{}, err
+		}
+		a.mu.Lock()
+		session, ok = a.sessions[profile]
+		a.mu.Unlock()
+	}
+
+	if !ok || a.expiring(session) {
+		var err error
+		if session, err = a.load(profile); err != nil {
+			return aws.Profile{}, err
+		}
+	}
+
+	if expiration, ok := session.SessionExpiration(); ok && !time.Now().Before(expiration) {
+		return aws.Profile{}, &aws.Error{
+			Kind: aws.ErrorExpiredSession,
+			Err:  errors.Errorf("the session of profile %s has expired, run awsctl agent auth --profile %s", profile, profile),
+		}
+	}
+	return session, nil
+}
+
+// load loads the session of the profile into the cache. A session that fails
+// to load stays cached until it expires. Concurrent loads of the same profile
+// share a single one, which runs without holding a.mu.
+func (a *Agent) load(profile string) (aws.Profile, error) {
+	err := a.do("load "+profile, func() error { return a.fetch(profile) })
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopped {
+		return aws.Profile{}, errStopping
+	}
+	cached, ok := a.sessions[profile]
+	if err != nil {
+		if ok {
+			if expiration, ok := cached.SessionExpiration(); !ok || time.Now().Before(expiration) {
+				return cached, nil
+			}
+		}
+		return aws.Profile{}, err
+	}
+	return cached, nil
+}
+
+// fetch loads the session of the profile and swaps it into the cache.
+func (a *Agent) fetch(profile string) error {
+	session, err := a.Credentials(profile)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.stopped {
+		a.sessions[profile] = session
+	}
+	return nil
+}
+
+// do runs fn, unless a call with the same key is in progress, in which case it
+// waits for that call instead and returns its error.
+func (a *Agent) do(key string, fn func() error) error {
+	a.mu.Lock()
+	if f, ok := a.flights[key]; ok {
+		a.mu.Unlock()
+		<-f.done
+		return f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	a.flights[key] = f
+	a.mu.Unlock()
+
+	f.err = fn()
+
+	a.mu.Lock()
+	delete(a.flights, key)
+	a.mu.Unlock()
+	close(f.done)
+	return f.err
+}
+
+func (a *Agent) expiring(session aws.Profile) bool {
+	expiration, ok := session.SessionExpiration()
+	return ok && time.Until(expiration) <= a.RefreshWindow
+}
+
+// Call sends the request to the agent listening on the socket and returns its
+// response. Errors reported by the agent are returned as errors.
+func Call(socket string, request Request) (Response, error) {
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return Response{}, errors.Errorf("no agent is listening on %s, start one with awsctl agent start", socket)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	if err = json.NewEncoder(conn).Encode(request); err != nil {
+		return Response{}, errors.Wrap(err, "failed to send request to the agent")
+	}
+
+	var response Response
+	if err = json.NewDecoder(conn).Decode(&response); err != nil {
+		return Response{}, errors.Wrap(err, "failed to read response of the agent")
+	}
+	if response.Error != "" {
+		err = errors.New(response.Error)
+		if response.Kind != "" && response.Kind != aws.ErrorUnknown {
+			err = &aws.Error{Kind: response.Kind, Err: err}
+		}
+		return response, err
+	}
+	return response, nil
+}
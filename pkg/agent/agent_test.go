@@ -0,0 +1,289 @@
+package agent
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+// startAgent serves the agent on a socket in a temporary directory. The
+// returned channel receives the result of Serve; the returned function stops
+// the agent and removes the directory.
+func startAgent(t *testing.T, a *Agent) (string, chan error, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "awsctl", "agent.sock")
+
+	listener, err := Listen(socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Serve(listener)
+	}()
+	return socket, done, func() {
+		a.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitServe waits for Serve to return.
+func waitServe(t *testing.T, done chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the agent did not stop")
+	}
+}
+
+func testSession(expiration time.Time) aws.Profile {
+	return aws.Profile{
+		AccessKeyID:              "ASIAEXAMPLE",
+		SecretAccessKey:          "secret",
+		SessionToken:             "token",
+		AuthenticationExpiration: expiration.UTC().Format(time.RFC3339),
+	}
+}
+
+func TestListen(t *testing.T) {
+	a := &Agent{Credentials: func(string) (aws.Profile, error) { return aws.Profile{}, nil }}
+	socket, _, cleanup := startAgent(t, a)
+	defer cleanup()
+
+	// Windows has no Unix permissions, sockets are protected by their ACLs.
+	permissions := map[string]os.FileMode{socket: 0600, filepath.Dir(socket): 0700}
+	if runtime.GOOS == "windows" {
+		permissions = nil
+	}
+	for path, want := range permissions {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != want {
+			t.Errorf("permissions of %s = %o, want %o", path, perm, want)
+		}
+	}
+
+	if _, err := Listen(socket); err == nil || !strings.Contains(err.Error(), "already listening") {
+		t.Errorf("second Listen() = %v, want an agent to be listening already", err)
+	}
+}
+
+func TestListenStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	if err = ioutil.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("stale socket was not replaced: %s", err)
+	}
+	listener.Close()
+}
+
+func TestProtocol(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		loads int
+	)
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	a := &Agent{
+		Credentials: func(profile string) (aws.Profile, error) {
+			mu.Lock()
+			loads++
+			mu.Unlock()
+			switch profile {
+			case "cowboy":
+				return testSession(expiration), nil
+			case "expired":
+				return testSession(time.Now().Add(-time.Minute)), nil
+			}
+			return aws.Profile{}, aws.ProfileNotFoundError(profile)
+		},
+		RefreshWindow: 5 * time.Minute,
+		IdleTimeout:   time.Hour,
+	}
+	socket, _, cleanup := startAgent(t, a)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		response, err := Call(socket, Request{Op: OpCredentials, Profile: "cowboy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Credentials{
+			AccessKeyID:     "ASIAEXAMPLE",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+			Expiration:      expiration.UTC().Format(time.RFC3339),
+		}
+		if response.Credentials == nil || *response.Credentials != want {
+			t.Errorf("credentials = %+v, want %+v", response.Credentials, want)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("session was loaded %d times, want it cached", loads)
+	}
+
+	failures := []struct {
+		request Request
+		kind    aws.ErrorKind
+		message string
+	}{
+		{Request{Op: OpCredentials, Profile: "expired"}, aws.ErrorExpiredSession, "awsctl agent auth --profile expired"},
+		{Request{Op: OpCredentials, Profile: "missing"}, aws.ErrorProfileNotFound, "missing"},
+		{Request{Op: OpCredentials}, "", "no profile requested"},
+		{Request{Op: OpAuth, Profile: "cowboy", Token: "123456"}, "", "cannot authenticate"},
+		{Request{Op: "unlock"}, "", "unknown operation: unlock"},
+	}
+	for _, test := range failures {
+		_, err := Call(socket, test.request)
+		if err == nil || !strings.Contains(err.Error(), test.message) || aws.KindOf(err) != test.kind && test.kind != "" {
+			t.Errorf("Call(%+v) = %v (%s), want %q (%s)", test.request, err, aws.KindOf(err), test.message, test.kind)
+		}
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("not json\n"))
+	b, _ := ioutil.ReadAll(conn)
+	conn.Close()
+	if !strings.Contains(string(b), "invalid request") {
+		t.Errorf("response to an invalid request = %s", b)
+	}
+
+	response, err := Call(socket, Request{Op: OpStatus})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := response.Status
+	if status.PID != os.Getpid() || status.IdleTimeout != 3600 || len(status.Sessions) != 2 ||
+		status.Sessions[0].Profile != "cowboy" || status.Sessions[1].Profile != "expired" {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		tokens  []string
+		session aws.Profile
+	)
+	release := make(chan struct{})
+	a := &Agent{
+		Credentials: func(profile string) (aws.Profile, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return session, nil
+		},
+		Authenticate: func(profile, token string) error {
+			mu.Lock()
+			tokens = append(tokens, token)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			session = testSession(time.Now().Add(time.Hour))
+			mu.Unlock()
+			return nil
+		},
+		RefreshWindow: 5 * time.Minute,
+	}
+	socket, _, cleanup := startAgent(t, a)
+	defer cleanup()
+
+	// Both requests share the authentication that is in progress.
+	responses := make(chan error, 2)
+	auth := func(token string) {
+		response, err := Call(socket, Request{Op: OpAuth, Profile: "cowboy", Token: token})
+		if err == nil && response.Credentials.SessionToken != "token" {
+			err = os.ErrInvalid
+		}
+		responses <- err
+	}
+	go auth("111111")
+	for started := false; !started; time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		started = len(tokens) > 0
+		mu.Unlock()
+	}
+	go auth("222222")
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-responses; err != nil {
+			t.Errorf("auth request failed: %v", err)
+		}
+	}
+	if len(tokens) != 1 || tokens[0] != "111111" {
+		t.Errorf("authenticated with %v, want only the first token", tokens)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	a := &Agent{
+		Credentials: func(string) (aws.Profile, error) { return testSession(time.Now().Add(time.Hour)), nil },
+		IdleTimeout: 100 * time.Millisecond,
+		interval:    10 * time.Millisecond,
+	}
+	socket, done, cleanup := startAgent(t, a)
+	defer cleanup()
+
+	if _, err := Call(socket, Request{Op: OpCredentials, Profile: "cowboy"}); err != nil {
+		t.Fatal(err)
+	}
+	waitServe(t, done)
+
+	if len(a.sessions) != 0 {
+		t.Errorf("idle agent kept %d sessions", len(a.sessions))
+	}
+	if _, err := Call(socket, Request{Op: OpStatus}); err == nil {
+		t.Error("idle agent still answers")
+	}
+}
+
+func TestStop(t *testing.T) {
+	a := &Agent{Credentials: func(string) (aws.Profile, error) { return testSession(time.Now().Add(time.Hour)), nil }}
+	socket, done, cleanup := startAgent(t, a)
+	defer cleanup()
+
+	if _, err := Call(socket, Request{Op: OpCredentials, Profile: "cowboy"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Call(socket, Request{Op: OpStop}); err != nil {
+		t.Fatal(err)
+	}
+	waitServe(t, done)
+
+	if len(a.sessions) != 0 {
+		t.Errorf("stopped agent kept %d sessions", len(a.sessions))
+	}
+	if _, err := Call(socket, Request{Op: OpStatus}); err == nil || !strings.Contains(err.Error(), "no agent is listening") {
+		t.Errorf("Call() after stop = %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+const (
+	// ResultSuccess marks an operation that succeeded.
+	ResultSuccess = "success"
+	// ResultFailure marks an operation that failed.
+	ResultFailure = "failure"
+)
+
+// Operations that are recorded in the audit log.
+const (
+	OperationAuth     = "auth"
+	OperationAssume   = "assume"
+	OperationFederate = "federate"
+	OperationNew      = "new"
+	OperationRemove   = "remove"
+	OperationUpdate   = "update"
+)
+
+// Record is a single entry of the audit log. It never holds secrets, such as
+// keys, session tokens or MFA codes.
+type Record struct {
+	Time              time.Time `json:"time"`
+	Profile           string    `json:"profile"`
+	Operation         string    `json:"operation"`
+	CallerARN         string    `json:"caller_arn,omitempty"`
+	MFASerial         string    `json:"mfa_serial,omitempty"`
+	RequestedDuration int64     `json:"requested_duration,omitempty"`
+	GrantedDuration   int64     `json:"granted_duration,omitempty"`
+	Changes           []string  `json:"changes,omitempty"`
+	Result            string    `json:"result"`
+	ErrorClass        string    `json:"error_class,omitempty"`
+}
+
+// Filter selects records of the audit log. Zero values match every record.
+type Filter struct {
+	Profiles  []string
+	Operation string
+	Result    string
+	Since     time.Time
+}
+
+// Match reports whether the record is selected by the filter.
+func (f Filter) Match(r Record) bool {
+	if len(f.Profiles) > 0 && !contains(f.Profiles, r.Profile) {
+		return false
+	}
+	if f.Operation != "" && r.Operation != f.Operation {
+		return false
+	}
+	if f.Result != "" && r.Result != f.Result {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Log is an append-only audit log file with one JSON encoded Record per line.
+type Log struct {
+	filename string
+}
+
+// NewLog returns the audit log stored at filename.
+func NewLog(filename string) *Log {
+	return &Log{filename: filename}
+}
+
+// Append adds the record to the end of the log, creating the log and its
+// directory if they do not exist yet. Only the owner may read the log.
+func (l *Log) Append(r Record) error {
+	if err := os.MkdirAll(filepath.Dir(l.filename), 0700); err != nil {
+		return errors.Wrapf(err, "failed to make directory: %s", filepath.Dir(l.filename))
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit record")
+	}
+
+	file, err := os.OpenFile(l.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open audit log: %s", l.filename)
+	}
+
+	if _, err = file.Write(append(b, '\n')); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "failed to write audit log: %s", l.filename)
+	}
+	return file.Close()
+}
+
+// Records returns every record of the log selected by the filter, oldest
+// first. A missing log has no records.
+func (l *Log) Records(f Filter) ([]Record, error) {
+	file, err := os.Open(l.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open audit log: %s", l.filename)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse line %d of audit log: %s", line, l.filename)
+		}
+		if f.Match(r) {
+			records = append(records, r)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read audit log: %s", l.filename)
+	}
+
+	return records, nil
+}
+
+// ErrorClass returns a short classification of err that is safe to record,
+// i.e. the error code of AWS errors or the kind of awsctl errors, rather than
+// its full message.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		return aerr.Code()
+	}
+	if kind := aws.KindOf(err); kind != aws.ErrorUnknown {
+		return string(kind)
+	}
+	return "error"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
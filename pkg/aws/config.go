@@ -0,0 +1,295 @@
+package aws
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keyRoleARN           = "role_arn"
+	keySourceProfile     = "source_profile"
+	keyExternalID        = "external_id"
+	keyDurationSeconds   = "duration_seconds"
+	keyCredentialProcess = "credential_process"
+	keyOutput            = "output"
+	keySSOSession        = "sso_session"
+	keySSOStartURL       = "sso_start_url"
+	keySSORegion         = "sso_region"
+	keySSOAccountID      = "sso_account_id"
+	keySSORoleName       = "sso_role_name"
+	keySSORegistration   = "sso_registration_scopes"
+
+	// DefaultProfile is the name of the profile used when none is specified.
+	DefaultProfile = "default"
+
+	prefixProfile    = "profile "
+	prefixSSOSession = "sso-session "
+	prefixServices   = "services "
+)
+
+// SectionType identifies what a section of the AWS config file describes.
+type SectionType int
+
+const (
+	// SectionUnknown is any section the AWS CLI ignores.
+	SectionUnknown SectionType = iota
+	// SectionProfile is a "[default]" or "[profile NAME]" section.
+	SectionProfile
+	// SectionSSOSession is a "[sso-session NAME]" section.
+	SectionSSOSession
+	// SectionServices is a "[services NAME]" section.
+	SectionServices
+)
+
+// ParseConfigSection returns the type and the unprefixed name of a section
+// header from the AWS config file, e.g. "profile cowboy" is a SectionProfile
+// named "cowboy".
+func ParseConfigSection(section string) (SectionType, string) {
+	switch {
+	case section == DefaultProfile:
+		return SectionProfile, DefaultProfile
+	case strings.HasPrefix(section, prefixProfile):
+		return SectionProfile, strings.TrimSpace(strings.TrimPrefix(section, prefixProfile))
+	case strings.HasPrefix(section, prefixSSOSession):
+		return SectionSSOSession, strings.TrimSpace(strings.TrimPrefix(section, prefixSSOSession))
+	case strings.HasPrefix(section, prefixServices):
+		return SectionServices, strings.TrimSpace(strings.TrimPrefix(section, prefixServices))
+	}
+	return SectionUnknown, section
+}
+
+// ConfigSection returns the section header of the profile within the AWS
+// config file. The default profile is the only one without a "profile "
+// prefix.
+func ConfigSection(profile string) string {
+	if profile == DefaultProfile {
+		return DefaultProfile
+	}
+	return prefixProfile + profile
+}
+
+// CredentialsSection returns the section header of the profile within the AWS
+// credentials file, which never uses a prefix.
+func CredentialsSection(profile string) string {
+	return profile
+}
+
+// SSOSession represents a "[sso-session NAME]" section of the AWS config file.
+type SSOSession struct {
+	Name               string
+	StartURL           string
+	Region             string
+	RegistrationScopes string
+	// Extra holds every key that is not modeled above.
+	Extra map[string]string
+}
+
+// parseProfile builds a Profile from its config and credentials sections,
+// either of which may be nil. Values from the credentials file take precedence,
+// matching the AWS CLI.
+func parseProfile(name string, sections ...*Section) (Profile, error) {
+
+	p := Profile{Name: name, Extra: map[string]string{}}
+	for _, section := range sections {
+		for _, key := range section.Keys() {
+			if err := p.set(key.Name, key.Value); err != nil {
+				return Profile{}, errors.Wrapf(err, "invalid profile: %s", name)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// set assigns the value of a single AWS config key to the Profile.
+func (p *Profile) set(key, value string) error {
+	switch key {
+	case keyAccessKeyID:
+		p.AccessKeyID = value
+	case keySecretAccessKey:
+		p.SecretAccessKey = value
+	case keySessionToken:
+		p.SessionToken = value
+	case keyMFASerial:
+		p.MFASerial = value
+	case keyRegion:
+		p.Region = value
+	case keyOutput:
+		p.Output = value
+	case keySTSRegionalEndpoints:
+		p.STSRegionalEndpoints = value
+	case keySTSEndpointURL:
+		p.STSEndpointURL = value
+	case keyRoleARN:
+		p.RoleARN = value
+	case keySourceProfile:
+		p.SourceProfile = value
+	case keyExternalID:
+		p.ExternalID = value
+	case keyDurationSeconds:
+		if value == "" {
+			return nil
+		}
+		duration, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "%s must be a number of seconds", keyDurationSeconds)
+		}
+		p.DurationSeconds = duration
+	case keyCredentialProcess:
+		p.CredentialProcess = value
+	case keySSOSession:
+		p.SSOSession = value
+	case keySSOStartURL:
+		p.SSOStartURL = value
+	case keySSORegion:
+		p.SSORegion = value
+	case keySSOAccountID:
+		p.SSOAccountID = value
+	case keySSORoleName:
+		p.SSORoleName = value
+	case keyAuthenticationExpiration:
+		p.AuthenticationExpiration = value
+	default:
+		p.Extra[key] = value
+	}
+	return nil
+}
+
+// Profiles returns every profile defined within the config or credentials
+// files, merged by name and sorted by name.
+func (s *Store) Profiles() ([]Profile, error) {
+
+	names := map[string]bool{}
+	for _, section := range s.Config.Sections() {
+		if kind, name := ParseConfigSection(section.Name()); kind == SectionProfile {
+			names[name] = true
+		}
+	}
+	for _, section := range s.Credentials.Sections() {
+		names[section.Name()] = true
+	}
+
+	var profiles []Profile
+	for name := range names {
+		profile, err := s.Profile(name)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+
+	return profiles, nil
+}
+
+// Profile returns the specific profile, merged from the config and credentials
+// files.
+func (s *Store) Profile(name string) (Profile, error) {
+	return parseProfile(name, s.Config.Section(ConfigSection(name)), s.Credentials.Section(CredentialsSection(name)))
+}
+
+// HasProfile reports whether the specific profile is defined within either the
+// config or credentials file.
+func (s *Store) HasProfile(name string) bool {
+	return s.Config.HasSection(ConfigSection(name)) || s.Credentials.HasSection(CredentialsSection(name))
+}
+
+// SSOSessions returns every "[sso-session NAME]" section of the config file.
+func (s *Store) SSOSessions() []SSOSession {
+
+	var sessions []SSOSession
+	for _, section := range s.Config.Sections() {
+		kind, name := ParseConfigSection(section.Name())
+		if kind != SectionSSOSession {
+			continue
+		}
+		session := SSOSession{Name: name, Extra: map[string]string{}}
+		for _, key := range section.Keys() {
+			switch key.Name {
+			case keySSOStartURL:
+				session.StartURL = key.Value
+			case keySSORegion:
+				session.Region = key.Value
+			case keySSORegistration:
+				session.RegistrationScopes = key.Value
+			default:
+				session.Extra[key.Name] = key.Value
+			}
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+// Dependents returns the names of every profile whose "source_profile" is the
+// specific profile, in order.
+func (s *Store) Dependents(profile string) []string {
+	var dependents []string
+	for _, section := range s.Config.Sections() {
+		kind, name := ParseConfigSection(section.Name())
+		if kind == SectionProfile && name != profile && section.Value(keySourceProfile) == profile {
+			dependents = append(dependents, name)
+		}
+	}
+	return dependents
+}
+
+// MatchProfiles resolves profile names and glob patterns, such as "dev-*", to
+// the names of existing profiles in order. Patterns never match session
+// profiles, since those are managed together with their base profile, but a
+// session profile can still be named explicitly. It fails if a name does not
+// exist or a pattern matches nothing.
+func (s *Store) MatchProfiles(patterns []string) ([]string, error) {
+
+	profiles, err := s.Profiles()
+	if err != nil {
+		return nil, err
+	}
+	sessions := s.Sessions()
+
+	var (
+		matches []string
+		seen    = map[string]bool{}
+	)
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if !s.HasProfile(pattern) {
+				return nil, ProfileNotFoundError(pattern)
+			}
+			if !seen[pattern] {
+				seen[pattern] = true
+				matches = append(matches, pattern)
+			}
+			continue
+		}
+
+		var matched bool
+		for _, p := range profiles {
+			if _, ok := sessions[p.Name]; ok {
+				continue
+			}
+			ok, err := path.Match(pattern, p.Name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern: %s", pattern)
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				matches = append(matches, p.Name)
+			}
+		}
+		if !matched {
+			return nil, errors.Errorf("no profiles match: %s", pattern)
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,187 @@
+package aws
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestStore returns a store of the AWS files with the contents, which is
+// never saved.
+func newTestStore(config, credentials string) *Store {
+	return &Store{
+		Config:      ParseFile([]byte(config)),
+		Credentials: ParseFile([]byte(credentials)),
+	}
+}
+
+func TestParseConfigSection(t *testing.T) {
+	tests := []struct {
+		section string
+		kind    SectionType
+		name    string
+	}{
+		{"default", SectionProfile, "default"},
+		{"profile cowboy", SectionProfile, "cowboy"},
+		{"profile  cowboy ", SectionProfile, "cowboy"},
+		{"sso-session corp", SectionSSOSession, "corp"},
+		{"services local", SectionServices, "local"},
+		{"cowboy", SectionUnknown, "cowboy"},
+		{"plugins", SectionUnknown, "plugins"},
+	}
+
+	for _, test := range tests {
+		kind, name := ParseConfigSection(test.section)
+		if kind != test.kind || name != test.name {
+			t.Errorf("ParseConfigSection(%q) = %v, %q, want %v, %q", test.section, kind, name, test.kind, test.name)
+		}
+	}
+}
+
+func TestConfigSection(t *testing.T) {
+	tests := map[string]string{
+		"default": "default",
+		"cowboy":  "profile cowboy",
+	}
+
+	for profile, want := range tests {
+		if got := ConfigSection(profile); got != want {
+			t.Errorf("ConfigSection(%q) = %q, want %q", profile, got, want)
+		}
+	}
+}
+
+func TestStoreProfile(t *testing.T) {
+	store := newTestStore(`[profile cowboy]
+region = eu-west-1
+output = json
+mfa_serial = arn:aws:iam::123456789012:mfa/cowboy
+aws_access_key_id = AKIACONFIG
+duration_seconds = 3600
+cli_pager =
+
+[profile admin]
+role_arn = arn:aws:iam::123456789012:role/admin
+source_profile = cowboy
+external_id = secret
+
+[profile sso]
+sso_session = corp
+sso_account_id = 123456789012
+sso_role_name = ReadOnly
+`, `[cowboy]
+aws_access_key_id = AKIACREDENTIALS
+aws_secret_access_key = secret
+`)
+
+	tests := []struct {
+		name string
+		want Profile
+	}{
+		{"cowboy", Profile{
+			Name:            "cowboy",
+			AccessKeyID:     "AKIACREDENTIALS",
+			SecretAccessKey: "secret",
+			MFASerial:       "arn:aws:iam::123456789012:mfa/cowboy",
+			Region:          "eu-west-1",
+			Output:          "json",
+			DurationSeconds: 3600,
+			Extra:           map[string]string{"cli_pager": ""},
+		}},
+		{"admin", Profile{
+			Name:          "admin",
+			RoleARN:       "arn:aws:iam::123456789012:role/admin",
+			SourceProfile: "cowboy",
+			ExternalID:    "secret",
+			Extra:         map[string]string{},
+		}},
+		{"sso", Profile{
+			Name:         "sso",
+			SSOSession:   "corp",
+			SSOAccountID: "123456789012",
+			SSORoleName:  "ReadOnly",
+			Extra:        map[string]string{},
+		}},
+		{"missing", Profile{Name: "missing", Extra: map[string]string{}}},
+	}
+
+	for _, test := range tests {
+		got, err := store.Profile(test.name)
+		if err != nil {
+			t.Errorf("Profile(%q): %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Profile(%q) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	if p, _ := store.Profile("admin"); !p.IsRole() || p.IsSSO() {
+		t.Error("admin is not a role profile")
+	}
+	if p, _ := store.Profile("sso"); p.IsRole() || !p.IsSSO() {
+		t.Error("sso is not an SSO profile")
+	}
+}
+
+func TestStoreProfileInvalidDuration(t *testing.T) {
+	store := newTestStore("[profile cowboy]\nduration_seconds = 1h\n", "")
+	if _, err := store.Profile("cowboy"); err == nil {
+		t.Error("invalid duration_seconds was accepted")
+	}
+}
+
+func TestStoreProfiles(t *testing.T) {
+	store := newTestStore(`[default]
+region = us-east-1
+[profile cowboy]
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+[services local]
+`, `[keys-only]
+aws_access_key_id = AKIA
+[cowboy]
+aws_access_key_id = AKIA
+`)
+
+	profiles, err := store.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+	}
+	if want := []string{"cowboy", "default", "keys-only"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Profiles() = %v, want %v", names, want)
+	}
+
+	sessions := store.SSOSessions()
+	if len(sessions) != 1 || sessions[0].Name != "corp" || sessions[0].StartURL != "https://corp.awsapps.com/start" {
+		t.Errorf("SSOSessions() = %+v", sessions)
+	}
+}
+
+// openTestStore writes the AWS files with the contents to a temporary
+// directory and opens them, so the store can be saved. The returned function
+// removes the directory.
+func openTestStore(t *testing.T, config, credentials string) (*Store, func()) {
+	t.Helper()
+	dir, cleanup := tempDir(t)
+	configFile, credentialsFile := filepath.Join(dir, "config"), filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(credentialsFile, []byte(credentials), 0600); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	store, err := OpenStore(configFile, credentialsFile)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return store, cleanup
+}
@@ -0,0 +1,257 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+const (
+	// federationIssuer identifies awsctl to the federation endpoint.
+	federationIssuer = "awsctl"
+
+	// defaultRoleSessionName names role sessions of profiles without a
+	// role_session_name.
+	defaultRoleSessionName = "awsctl-console"
+
+	keyRoleSessionName = "role_session_name"
+
+	// readOnlyPolicy is the managed policy that scopes federated users unless
+	// another policy is given.
+	readOnlyPolicy = "iam::aws:policy/ReadOnlyAccess"
+)
+
+var (
+	// FederationTokenLimits are the limits of federation tokens, which are
+	// also the limits of the console sessions created with them.
+	FederationTokenLimits = DurationLimits{
+		API:    "GetFederationToken",
+		Min:    15 * time.Minute,
+		Max:    36 * time.Hour,
+		Reason: "the maximum of GetFederationToken for IAM users",
+	}
+
+	// ConsoleSessionLimits are the limits of console sessions created with
+	// role credentials.
+	ConsoleSessionLimits = DurationLimits{
+		API:    "getSigninToken",
+		Min:    15 * time.Minute,
+		Max:    12 * time.Hour,
+		Reason: "the maximum console session duration of role credentials",
+	}
+
+	// consoleEndpoints are the federation and console endpoints of the
+	// partitions that have them.
+	consoleEndpoints = map[string]struct {
+		federation string
+		console    string
+	}{
+		"aws":        {"https://signin.aws.amazon.com/federation", "https://console.aws.amazon.com/"},
+		"aws-cn":     {"https://signin.amazonaws.cn/federation", "https://console.amazonaws.cn/"},
+		"aws-us-gov": {"https://signin.amazonaws-us-gov.com/federation", "https://console.amazonaws-us-gov.com/"},
+	}
+
+	// federatedUserName matches invalid characters of federated user names.
+	federatedUserName = regexp.MustCompile(`[^\w+=,.@-]`)
+)
+
+// ConsoleEndpoints returns the federation endpoint and the console URL of the
+// partition of the region.
+func ConsoleEndpoints(region string) (string, string, error) {
+	partition, ok := PartitionForRegion(region)
+	if !ok {
+		return "", "", &UnknownRegionError{Region: region, Suggestion: suggestRegion(region)}
+	}
+
+	endpoints, ok := consoleEndpoints[partition.ID]
+	if !ok {
+		return "", "", errors.Errorf("the %s partition has no known federation endpoint, set one explicitly", partition.ID)
+	}
+	return endpoints.federation, endpoints.console, nil
+}
+
+// FederationPolicy scopes the permissions of a federated user, which never
+// exceed those of the IAM user. Without any policy a federated user has no
+// permissions at all.
+type FederationPolicy struct {
+	// Document is an inline policy document.
+	Document string
+	// ARNs are the ARNs of managed policies.
+	ARNs []string
+}
+
+// ReadOnlyPolicy returns the policy of federated users of the region's
+// partition that may only read, the AWS managed ReadOnlyAccess policy.
+func ReadOnlyPolicy(region string) FederationPolicy {
+	partition := "aws"
+	if p, ok := PartitionForRegion(region); ok {
+		partition = p.ID
+	}
+	return FederationPolicy{ARNs: []string{"arn:" + partition + ":" + readOnlyPolicy}}
+}
+
+// FederationToken returns federated user credentials for the long-term keys of
+// the base profile, scoped by policy, and the ARN of the federated user.
+// Unlike the credentials of MFA sessions, they can sign in to the console, but
+// the federated user is not MFA authenticated.
+func FederationToken(stsConfig STSConfig, base Profile, duration int64, policy FederationPolicy) (Profile, string, error) {
+
+	if base.AccessKeyID == "" || base.SecretAccessKey == "" {
+		return Profile{}, "", errors.Errorf("profile %s has no long-term access keys to request a federation token with", base.Name)
+	}
+	if policy.Document == "" && len(policy.ARNs) == 0 {
+		return Profile{}, "", errors.New("a federation token needs a policy, a federated user without one has no permissions")
+	}
+
+	creds := credentials.NewStaticCredentials(base.AccessKeyID, base.SecretAccessKey, "")
+	svc, err := stsConfig.client(creds)
+	if err != nil {
+		return Profile{}, "", err
+	}
+
+	// Federated user names are 2 to 32 characters long.
+	name := federatedUserName.ReplaceAllString(base.Name, "-")
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	for len(name) < 2 {
+		name += "-"
+	}
+
+	input := &sts.GetFederationTokenInput{
+		DurationSeconds: aws.Int64(duration),
+		Name:            aws.String(name),
+	}
+	if policy.Document != "" {
+		input.Policy = aws.String(policy.Document)
+	}
+	for _, arn := range policy.ARNs {
+		input.PolicyArns = append(input.PolicyArns, &sts.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+
+	result, err := svc.GetFederationToken(input)
+	if err != nil {
+		return Profile{}, "", requestError(err, "get federation token failed")
+	}
+
+	var arn string
+	if result.FederatedUser != nil {
+		arn = aws.StringValue(result.FederatedUser.Arn)
+	}
+	return temporaryProfile(result.Credentials), arn, nil
+}
+
+// AssumeRole returns the credentials of a session of the role profile, using
+// the credentials of source, e.g. the MFA session of its source_profile, and
+// the ARN of the assumed role session.
+func AssumeRole(stsConfig STSConfig, role, source Profile) (Profile, string, error) {
+
+	creds := credentials.NewStaticCredentials(source.AccessKeyID, source.SecretAccessKey, source.SessionToken)
+	svc, err := stsConfig.client(creds)
+	if err != nil {
+		return Profile{}, "", err
+	}
+
+	sessionName := role.Extra[keyRoleSessionName]
+	if sessionName == "" {
+		sessionName = defaultRoleSessionName
+	}
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(role.RoleARN),
+		RoleSessionName: aws.String(sessionName),
+	}
+	if role.ExternalID != "" {
+		input.ExternalId = aws.String(role.ExternalID)
+	}
+	if role.DurationSeconds > 0 {
+		input.DurationSeconds = aws.Int64(role.DurationSeconds)
+	}
+
+	result, err := svc.AssumeRole(input)
+	if err != nil {
+		return Profile{}, "", requestError(err, "assume role failed")
+	}
+
+	var arn string
+	if result.AssumedRoleUser != nil {
+		arn = aws.StringValue(result.AssumedRoleUser.Arn)
+	}
+	return temporaryProfile(result.Credentials), arn, nil
+}
+
+func temporaryProfile(creds *sts.Credentials) Profile {
+	p := Profile{
+		AccessKeyID:     aws.StringValue(creds.AccessKeyId),
+		SecretAccessKey: aws.StringValue(creds.SecretAccessKey),
+		SessionToken:    aws.StringValue(creds.SessionToken),
+	}
+	if creds.Expiration != nil {
+		p.AuthenticationExpiration = creds.Expiration.Format(time.RFC3339)
+	}
+	return p
+}
+
+// SigninURL exchanges temporary credentials for a sign-in token at the
+// federation endpoint and returns a URL that signs in to the console and opens
+// destination. A sessionDuration of zero leaves the duration of the console
+// session to the federation endpoint; it can only be set for role
+// credentials.
+func SigninURL(endpoint, destination string, creds Profile, sessionDuration int64) (string, error) {
+
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    creds.AccessKeyID,
+		"sessionKey":   creds.SecretAccessKey,
+		"sessionToken": creds.SessionToken,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode session")
+	}
+
+	query := url.Values{}
+	query.Set("Action", "getSigninToken")
+	query.Set("Session", string(session))
+	if sessionDuration > 0 {
+		query.Set("SessionDuration", fmt.Sprint(sessionDuration))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(endpoint + "?" + query.Encode())
+	if err != nil {
+		// The URL of the request holds the credentials, keep it out of errors.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return "", errors.Wrapf(err, "failed to request a sign-in token from %s", endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &Error{
+			Kind: ErrorAccessDenied,
+			Err:  errors.Errorf("the federation endpoint refused the credentials: %s", resp.Status),
+		}
+	}
+
+	var result struct {
+		SigninToken string
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil || result.SigninToken == "" {
+		return "", errors.New("the federation endpoint returned no sign-in token")
+	}
+
+	query = url.Values{}
+	query.Set("Action", "login")
+	query.Set("Issuer", federationIssuer)
+	query.Set("Destination", destination)
+	query.Set("SigninToken", result.SigninToken)
+	return endpoint + "?" + query.Encode(), nil
+}
@@ -0,0 +1,195 @@
+package aws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var consoleTestCredentials = Profile{
+	AccessKeyID:     "ASIAROLE",
+	SecretAccessKey: "role-secret",
+	SessionToken:    "role-token",
+}
+
+func TestSigninURL(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"SigninToken":"signin-token"}`))
+	}))
+	defer srv.Close()
+
+	destination := "https://console.aws.amazon.com/ec2/home?region=eu-west-1"
+	signinURL, err := SigninURL(srv.URL, destination, consoleTestCredentials, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := query.Get("Action"); got != "getSigninToken" {
+		t.Errorf("got Action %q, want getSigninToken", got)
+	}
+	if got := query.Get("SessionDuration"); got != "3600" {
+		t.Errorf("got SessionDuration %q, want 3600", got)
+	}
+	var session map[string]string
+	if err = json.Unmarshal([]byte(query.Get("Session")), &session); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"sessionId": "ASIAROLE", "sessionKey": "role-secret", "sessionToken": "role-token"}
+	for key, value := range want {
+		if session[key] != value {
+			t.Errorf("got %s %q in the session, want %q", key, session[key], value)
+		}
+	}
+
+	u, err := url.Parse(signinURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != srv.URL {
+		t.Errorf("got sign-in URL at %s, want %s", got, srv.URL)
+	}
+	login := u.Query()
+	for key, value := range map[string]string{
+		"Action":      "login",
+		"Issuer":      federationIssuer,
+		"Destination": destination,
+		"SigninToken": "signin-token",
+	} {
+		if login.Get(key) != value {
+			t.Errorf("got %s %q in the sign-in URL, want %q", key, login.Get(key), value)
+		}
+	}
+}
+
+func TestSigninURLWithoutDuration(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"SigninToken":"signin-token"}`))
+	}))
+	defer srv.Close()
+
+	if _, err := SigninURL(srv.URL, "https://console.aws.amazon.com/", consoleTestCredentials, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := query["SessionDuration"]; ok {
+		t.Errorf("got SessionDuration %q, want none", query.Get("SessionDuration"))
+	}
+}
+
+func TestSigninURLRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	_, err := SigninURL(srv.URL, "https://console.aws.amazon.com/", consoleTestCredentials, 0)
+	if KindOf(err) != ErrorAccessDenied {
+		t.Errorf("got error %v, want an %s error", err, ErrorAccessDenied)
+	}
+	if err != nil && strings.Contains(err.Error(), "role-secret") {
+		t.Errorf("error holds the credentials: %s", err)
+	}
+}
+
+const getFederationTokenResponse = `<GetFederationTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetFederationTokenResult>
+    <Credentials>
+      <AccessKeyId>ASIAFEDERATED</AccessKeyId>
+      <SecretAccessKey>federated-secret</SecretAccessKey>
+      <SessionToken>federated-token</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <FederatedUser>
+      <Arn>arn:aws:sts::123456789012:federated-user/cowboy</Arn>
+      <FederatedUserId>123456789012:cowboy</FederatedUserId>
+    </FederatedUser>
+  </GetFederationTokenResult>
+</GetFederationTokenResponse>`
+
+func TestFederationToken(t *testing.T) {
+	var (
+		form          url.Values
+		authorization string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form, authorization = r.PostForm, r.Header.Get("Authorization")
+		w.Write([]byte(getFederationTokenResponse))
+	}))
+	defer srv.Close()
+
+	config := STSConfig{Region: "eu-west-1", EndpointURL: srv.URL}
+	base := Profile{Name: "cowboy@corp/dev", AccessKeyID: "AKIABASE", SecretAccessKey: "base-secret"}
+
+	tests := []struct {
+		name   string
+		policy FederationPolicy
+		want   map[string]string
+	}{
+		{"read-only", ReadOnlyPolicy("eu-west-1"), map[string]string{
+			"PolicyArns.member.1.arn": "arn:aws:iam::aws:policy/ReadOnlyAccess",
+			"Policy":                  "",
+		}},
+		{"inline and managed", FederationPolicy{Document: `{"Version":"2012-10-17"}`, ARNs: []string{"arn:aws:iam::aws:policy/A", "arn:aws:iam::aws:policy/B"}}, map[string]string{
+			"Policy":                  `{"Version":"2012-10-17"}`,
+			"PolicyArns.member.1.arn": "arn:aws:iam::aws:policy/A",
+			"PolicyArns.member.2.arn": "arn:aws:iam::aws:policy/B",
+		}},
+	}
+
+	for _, test := range tests {
+		creds, arn, err := FederationToken(config, base, 3600, test.policy)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if creds.AccessKeyID != "ASIAFEDERATED" || creds.SessionToken != "federated-token" || arn != "arn:aws:sts::123456789012:federated-user/cowboy" {
+			t.Errorf("%s: got %+v, %s", test.name, creds, arn)
+		}
+		if !strings.Contains(authorization, "Credential=AKIABASE/") {
+			t.Errorf("%s: request was not signed with the keys of the base profile: %s", test.name, authorization)
+		}
+		if name := form.Get("Name"); name != "cowboy@corp-dev" {
+			t.Errorf("%s: federated user name = %q", test.name, name)
+		}
+		if duration := form.Get("DurationSeconds"); duration != "3600" {
+			t.Errorf("%s: DurationSeconds = %q", test.name, duration)
+		}
+		for key, want := range test.want {
+			if got := form.Get(key); got != want {
+				t.Errorf("%s: %s = %q, want %q", test.name, key, got, want)
+			}
+		}
+	}
+}
+
+func TestFederationTokenRefused(t *testing.T) {
+	config := STSConfig{Region: "eu-west-1", EndpointURL: "http://127.0.0.1:1"}
+
+	if _, _, err := FederationToken(config, Profile{Name: "cowboy"}, 3600, ReadOnlyPolicy("eu-west-1")); err == nil {
+		t.Error("requested a federation token without long-term keys")
+	}
+	base := Profile{Name: "cowboy", AccessKeyID: "AKIABASE", SecretAccessKey: "base-secret"}
+	if _, _, err := FederationToken(config, base, 3600, FederationPolicy{}); err == nil {
+		t.Error("requested a federation token without a policy")
+	}
+}
+
+func TestReadOnlyPolicy(t *testing.T) {
+	tests := map[string]string{
+		"eu-west-1":     "arn:aws:iam::aws:policy/ReadOnlyAccess",
+		"cn-north-1":    "arn:aws-cn:iam::aws:policy/ReadOnlyAccess",
+		"us-gov-west-1": "arn:aws-us-gov:iam::aws:policy/ReadOnlyAccess",
+	}
+	for region, want := range tests {
+		if got := ReadOnlyPolicy(region).ARNs; len(got) != 1 || got[0] != want {
+			t.Errorf("ReadOnlyPolicy(%s) = %v, want %s", region, got, want)
+		}
+	}
+}
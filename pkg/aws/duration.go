@@ -0,0 +1,163 @@
+package aws
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// keySessionDuration is the duration of the MFA sessions of a base profile.
+	keySessionDuration = "awsctl_session_duration"
+
+	// DefaultSessionDuration is the duration of MFA sessions unless another
+	// one is configured. It matches the default of GetSessionToken.
+	DefaultSessionDuration = 12 * time.Hour
+)
+
+// DurationLimits are the session durations an STS API accepts.
+type DurationLimits struct {
+	API string
+	Min time.Duration
+	Max time.Duration
+	// Reason explains where the maximum comes from.
+	Reason string
+}
+
+var (
+	// GetSessionTokenLimits are the limits of MFA sessions of IAM users.
+	GetSessionTokenLimits = DurationLimits{
+		API:    "GetSessionToken",
+		Min:    15 * time.Minute,
+		Max:    36 * time.Hour,
+		Reason: "the maximum of GetSessionToken for IAM users",
+	}
+
+	// AssumeRoleLimits are the limits of role sessions. A role's own maximum
+	// session duration may be lower, see RoleSessionLimits.
+	AssumeRoleLimits = DurationLimits{
+		API:    "AssumeRole",
+		Min:    15 * time.Minute,
+		Max:    12 * time.Hour,
+		Reason: "the highest maximum session duration a role can be configured with",
+	}
+
+	// roleChainingMax is the maximum session duration when a role is assumed
+	// with the credentials of another role.
+	roleChainingMax = time.Hour
+)
+
+// RoleSessionLimits returns the limits of sessions of the role profile. Roles
+// assumed with the credentials of another role, i.e. role chaining, are
+// limited to one hour.
+func (s *Store) RoleSessionLimits(profile Profile) DurationLimits {
+	limits := AssumeRoleLimits
+	if source, err := s.Profile(profile.SourceProfile); err == nil && source.IsRole() {
+		limits.Max = roleChainingMax
+		limits.Reason = "the maximum for role chaining, since source_profile " + source.Name + " is a role itself"
+	}
+	return limits
+}
+
+// Validate checks that d is within the limits, explaining them if it is not.
+func (l DurationLimits) Validate(d time.Duration) error {
+	switch {
+	case d < l.Min:
+		return errors.Errorf("session duration %s is too short, %s requires at least %s (%d seconds)",
+			d, l.API, l.Min, int64(l.Min/time.Second))
+	case d > l.Max:
+		return errors.Errorf("session duration %s is too long, %s allows at most %s (%d seconds), %s",
+			d, l.API, l.Max, int64(l.Max/time.Second), l.Reason)
+	}
+	return nil
+}
+
+// ParseDuration parses a session duration. A plain number is a number of
+// seconds, otherwise units such as "12h", "90m" or "1h30m" are accepted, as
+// well as days, e.g. "1d".
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.ParseInt(strings.TrimSuffix(value, "d"), 10, 64); err == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Errorf("invalid session duration %q, use seconds or units such as 12h or 90m", value)
+	}
+	return d, nil
+}
+
+// SessionDuration returns the "awsctl_session_duration" setting of the base
+// profile. It reports false if the profile has none.
+func (s *Store) SessionDuration(base string) (time.Duration, bool, error) {
+	value := s.Config.Section(ConfigSection(base)).Value(keySessionDuration)
+	if value == "" {
+		return 0, false, nil
+	}
+
+	d, err := ParseDuration(value)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid %s of profile %s", keySessionDuration, base)
+	}
+	return d, true, nil
+}
+
+// SetSessionDuration stores the duration of the MFA sessions of the base
+// profile. A zero duration removes the setting.
+func (s *Store) SetSessionDuration(base string, d time.Duration) error {
+	if !s.HasProfile(base) {
+		return ProfileNotFoundError(base)
+	}
+
+	if d == 0 {
+		if section := s.Config.Section(ConfigSection(base)); section != nil {
+			section.DeleteKey(keySessionDuration)
+		}
+		return nil
+	}
+
+	s.Config.EnsureSection(ConfigSection(base)).SetValue(keySessionDuration, FormatDuration(d))
+	return nil
+}
+
+// FormatDuration formats d the way ParseDuration accepts it, e.g. "12h" or
+// "1h30m", rather than "12h0m0s".
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// SetRoleSessionDuration stores the "duration_seconds" of the role profile,
+// which the AWS CLI and SDKs request when they assume the role. A zero
+// duration removes the setting.
+func (s *Store) SetRoleSessionDuration(profile string, d time.Duration) error {
+	if !s.HasProfile(profile) {
+		return ProfileNotFoundError(profile)
+	}
+
+	if d == 0 {
+		if section := s.Config.Section(ConfigSection(profile)); section != nil {
+			section.DeleteKey(keyDurationSeconds)
+		}
+		return nil
+	}
+
+	s.Config.EnsureSection(ConfigSection(profile)).SetValue(keyDurationSeconds, strconv.FormatInt(int64(d/time.Second), 10))
+	return nil
+}
@@ -0,0 +1,137 @@
+package aws
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{"3600", time.Hour, false},
+		{" 900 ", 15 * time.Minute, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"1d", 24 * time.Hour, false},
+		{"", 0, true},
+		{"1w", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDuration(test.value)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("ParseDuration(%q) = %s, %v, want %s, error %v", test.value, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		12 * time.Hour:   "12h",
+		90 * time.Minute: "1h30m",
+		15 * time.Minute: "15m",
+		90 * time.Second: "1m30s",
+	}
+
+	for d, want := range tests {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%s) = %q, want %q", d, got, want)
+		}
+		if parsed, err := ParseDuration(FormatDuration(d)); err != nil || parsed != d {
+			t.Errorf("ParseDuration(FormatDuration(%s)) = %s, %v", d, parsed, err)
+		}
+	}
+}
+
+func TestDurationLimitsValidate(t *testing.T) {
+	tests := []struct {
+		limits DurationLimits
+		d      time.Duration
+		err    string
+	}{
+		{GetSessionTokenLimits, 15 * time.Minute, ""},
+		{GetSessionTokenLimits, 36 * time.Hour, ""},
+		{GetSessionTokenLimits, 14 * time.Minute, "too short, GetSessionToken requires at least 15m0s (900 seconds)"},
+		{GetSessionTokenLimits, 37 * time.Hour, "too long, GetSessionToken allows at most 36h0m0s (129600 seconds)"},
+		{AssumeRoleLimits, 12 * time.Hour, ""},
+		{AssumeRoleLimits, 13 * time.Hour, "the highest maximum session duration a role can be configured with"},
+	}
+
+	for _, test := range tests {
+		err := test.limits.Validate(test.d)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s.Validate(%s) = %v", test.limits.API, test.d, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s.Validate(%s) = %v, want %q", test.limits.API, test.d, err, test.err)
+		}
+	}
+}
+
+func TestRoleSessionLimits(t *testing.T) {
+	store := newTestStore(`[profile cowboy]
+[profile admin]
+role_arn = arn:aws:iam::123456789012:role/admin
+source_profile = cowboy
+[profile chained]
+role_arn = arn:aws:iam::123456789012:role/chained
+source_profile = admin
+`, "")
+
+	tests := map[string]time.Duration{
+		"admin":   12 * time.Hour,
+		"chained": time.Hour,
+	}
+	for name, want := range tests {
+		p, _ := store.Profile(name)
+		if got := store.RoleSessionLimits(p).Max; got != want {
+			t.Errorf("RoleSessionLimits(%s).Max = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSessionDuration(t *testing.T) {
+	store := newTestStore(`[profile cowboy]
+awsctl_session_duration = 1h30m
+[profile plain]
+[profile broken]
+awsctl_session_duration = forever
+`, "")
+
+	tests := []struct {
+		profile string
+		want    time.Duration
+		ok      bool
+		err     bool
+	}{
+		{"cowboy", 90 * time.Minute, true, false},
+		{"plain", 0, false, false},
+		{"missing", 0, false, false},
+		{"broken", 0, false, true},
+	}
+	for _, test := range tests {
+		got, ok, err := store.SessionDuration(test.profile)
+		if got != test.want || ok != test.ok || (err != nil) != test.err {
+			t.Errorf("SessionDuration(%s) = %s, %v, %v", test.profile, got, ok, err)
+		}
+	}
+
+	if err := store.SetSessionDuration("plain", 12*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Config.Section("profile plain").Value("awsctl_session_duration"); got != "12h" {
+		t.Errorf("awsctl_session_duration = %q, want 12h", got)
+	}
+	if err := store.SetSessionDuration("cowboy", 0); err != nil || store.Config.Section("profile cowboy").HasKey("awsctl_session_duration") {
+		t.Errorf("awsctl_session_duration was not removed: %v", err)
+	}
+	if err := store.SetSessionDuration("missing", time.Hour); KindOf(err) != ErrorProfileNotFound {
+		t.Errorf("SetSessionDuration(missing) = %v", err)
+	}
+}
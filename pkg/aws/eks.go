@@ -0,0 +1,65 @@
+package aws
+
+import (
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// eksTokenPrefix prefixes the tokens EKS clusters accept.
+	eksTokenPrefix = "k8s-aws-v1."
+	// eksClusterHeader binds a token to a single cluster.
+	eksClusterHeader = "x-k8s-aws-id"
+
+	// eksPresignExpiration is the expiration of the presigned URL within a
+	// token. EKS itself accepts tokens for EKSTokenLifetime after they were
+	// signed, regardless of it.
+	eksPresignExpiration = 60 * time.Second
+
+	// EKSTokenLifetime is how long clients may use a token, one minute less
+	// than EKS accepts it, so it is not used just before it expires.
+	EKSTokenLifetime = 14 * time.Minute
+)
+
+// EKSToken returns a token that authenticates to the EKS cluster as the
+// identity of the credentials, and when it expires. The token is a
+// GetCallerIdentity request to the STS endpoint described by stsConfig,
+// presigned for the cluster, which EKS sends on to STS. Creating it requires
+// no request.
+func EKSToken(stsConfig STSConfig, creds Profile, cluster string) (string, time.Time, error) {
+	return eksToken(stsConfig, creds, cluster, time.Now())
+}
+
+// eksToken returns a token like EKSToken, signed at now.
+func eksToken(stsConfig STSConfig, creds Profile, cluster string, now time.Time) (string, time.Time, error) {
+
+	if cluster == "" {
+		return "", time.Time{}, errors.New("cluster name must be set")
+	}
+
+	endpoint, signingRegion, err := stsConfig.Resolve()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	r, err := http.NewRequest(http.MethodGet, endpoint+"/?Action=GetCallerIdentity&Version=2011-06-15", nil)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to create GetCallerIdentity request")
+	}
+	r.Header.Set(eksClusterHeader, cluster)
+
+	if _, err = signer(creds, false).Presign(r, bodyReader(nil), "sts", signingRegion, eksPresignExpiration, now); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to presign request")
+	}
+
+	// The token cannot outlive the credentials it was signed with.
+	expiration := now.Add(EKSTokenLifetime)
+	if sessionExpiration, ok := creds.SessionExpiration(); ok && sessionExpiration.Before(expiration) {
+		expiration = sessionExpiration
+	}
+
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(r.URL.String())), expiration, nil
+}
@@ -0,0 +1,107 @@
+package aws
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var eksTestCredentials = Profile{
+	AccessKeyID:     "ASIAEKS",
+	SecretAccessKey: "eks-secret",
+	SessionToken:    "eks-token",
+}
+
+// decodeEKSToken returns the presigned URL within the token.
+func decodeEKSToken(t *testing.T, token string) *url.URL {
+	t.Helper()
+	if !strings.HasPrefix(token, "k8s-aws-v1.") {
+		t.Fatalf("token %q lacks the k8s-aws-v1. prefix", token)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, "k8s-aws-v1."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestEKSToken(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	config := STSConfig{Region: "eu-west-1"}
+
+	token, expiration, err := eksToken(config, eksTestCredentials, "cowboy-cluster", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := decodeEKSToken(t, token)
+	if got := u.Scheme + "://" + u.Host + u.Path; got != "https://sts.eu-west-1.amazonaws.com/" {
+		t.Errorf("got presigned URL at %s", got)
+	}
+	query := u.Query()
+	for key, value := range map[string]string{
+		"Action":               "GetCallerIdentity",
+		"Version":              "2011-06-15",
+		"X-Amz-Algorithm":      "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":     "ASIAEKS/20200102/eu-west-1/sts/aws4_request",
+		"X-Amz-Date":           "20200102T030405Z",
+		"X-Amz-Expires":        "60",
+		"X-Amz-Security-Token": "eks-token",
+	} {
+		if query.Get(key) != value {
+			t.Errorf("got %s %q, want %q", key, query.Get(key), value)
+		}
+	}
+	signed := strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	if !contains(signed, "x-k8s-aws-id") {
+		t.Errorf("x-k8s-aws-id is not signed: %v", signed)
+	}
+	if len(query.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("got signature %q", query.Get("X-Amz-Signature"))
+	}
+
+	if want := now.Add(EKSTokenLifetime); !expiration.Equal(want) {
+		t.Errorf("got expiration %s, want %s", expiration, want)
+	}
+
+	again, _, err := eksToken(config, eksTestCredentials, "cowboy-cluster", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != token {
+		t.Error("tokens signed at the same time differ")
+	}
+	other, _, err := eksToken(config, eksTestCredentials, "other-cluster", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodeEKSToken(t, other).Query().Get("X-Amz-Signature") == query.Get("X-Amz-Signature") {
+		t.Error("tokens of different clusters have the same signature")
+	}
+}
+
+func TestEKSTokenSessionExpiration(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	creds := eksTestCredentials
+	creds.AuthenticationExpiration = now.Add(5 * time.Minute).Format(time.RFC3339)
+
+	_, expiration, err := eksToken(STSConfig{Region: "eu-west-1"}, creds, "cowboy-cluster", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Add(5 * time.Minute); !expiration.Equal(want) {
+		t.Errorf("got expiration %s, want the session's %s", expiration, want)
+	}
+}
+
+func TestEKSTokenWithoutCluster(t *testing.T) {
+	if _, _, err := eksToken(STSConfig{Region: "eu-west-1"}, eksTestCredentials, "", time.Now()); err == nil {
+		t.Error("got a token without a cluster")
+	}
+}
@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies the errors returned by this package, so callers can
+// react to them without parsing error messages.
+type ErrorKind string
+
+const (
+	// ErrorUnknown is any error that is not classified.
+	ErrorUnknown ErrorKind = "unknown"
+	// ErrorProfileNotFound means a profile does not exist.
+	ErrorProfileNotFound ErrorKind = "profile_not_found"
+	// ErrorProfileExists means a profile already exists.
+	ErrorProfileExists ErrorKind = "profile_exists"
+	// ErrorInvalidMFAToken means the MFA token was malformed or rejected.
+	ErrorInvalidMFAToken ErrorKind = "invalid_mfa_token"
+	// ErrorAccessDenied means AWS rejected the credentials or the request,
+	// e.g. because the access keys were revoked.
+	ErrorAccessDenied ErrorKind = "access_denied"
+	// ErrorExpiredSession means the credentials of a session have expired.
+	ErrorExpiredSession ErrorKind = "expired_session"
+	// ErrorThrottled means AWS throttled the request.
+	ErrorThrottled ErrorKind = "throttled"
+	// ErrorFileIO means the AWS config or credentials files could not be read
+	// or written.
+	ErrorFileIO ErrorKind = "file_io"
+	// ErrorLockTimeout means another awsctl process held the lock of the AWS
+	// files for too long.
+	ErrorLockTimeout ErrorKind = "lock_timeout"
+)
+
+// Error is an error of a known ErrorKind.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error.
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// KindOf returns the ErrorKind of err, looking through errors that wrap it.
+func KindOf(err error) ErrorKind {
+	for err != nil {
+		if e, ok := err.(*Error); ok {
+			return e.Kind
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return ErrorUnknown
+}
+
+// ProfileNotFoundError returns an ErrorProfileNotFound error for the profile.
+func ProfileNotFoundError(profile string) error {
+	return &Error{Kind: ErrorProfileNotFound, Err: errors.Errorf("profile does not exist: %s", profile)}
+}
+
+// ProfileExistsError returns an ErrorProfileExists error for the profile.
+func ProfileExistsError(profile string) error {
+	return &Error{Kind: ErrorProfileExists, Err: errors.Errorf("profile already exists: %s", profile)}
+}
+
+// fileError wraps an error reading or writing a file as ErrorFileIO.
+func fileError(err error, message string) error {
+	return &Error{Kind: ErrorFileIO, Err: errors.Wrap(err, message)}
+}
+
+// requestError wraps an error returned by an AWS API and classifies it by its
+// error code.
+func requestError(err error, message string) error {
+	kind := ErrorUnknown
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "AccessDenied":
+			kind = ErrorAccessDenied
+			if strings.Contains(aerr.Message(), "MultiFactorAuthentication") {
+				kind = ErrorInvalidMFAToken
+			}
+		case "InvalidClientTokenId", "SignatureDoesNotMatch", "UnrecognizedClientException":
+			kind = ErrorAccessDenied
+		case "ExpiredToken", "ExpiredTokenException", "RequestExpired":
+			kind = ErrorExpiredSession
+		case "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+			kind = ErrorThrottled
+		}
+	}
+
+	if kind == ErrorUnknown {
+		return errors.Wrap(err, message)
+	}
+	return &Error{Kind: kind, Err: errors.Wrap(err, message)}
+}
@@ -0,0 +1,551 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// File is a format-preserving editor for the ini dialect used by the AWS
+// config and credentials files. Only the sections and keys that are changed
+// through the File are rewritten; comments, blank lines, ordering and nested
+// sub-settings such as:
+//
+//	s3 =
+//	  max_concurrent_requests = 20
+//
+// are written back exactly as they were read.
+type File struct {
+	// preamble holds every line before the first section header.
+	preamble []string
+	sections []*Section
+	// newline is the line ending detected when the file was parsed.
+	newline string
+	// trailingNewline records whether the original content ended with a
+	// newline.
+	trailingNewline bool
+}
+
+// Section is a single "[name]" block within a File.
+type Section struct {
+	name string
+	// leading holds the comment lines directly above the section header, which
+	// belong to the section and move or disappear together with it.
+	leading []string
+	// header is the original "[name]" line, or empty for new and renamed
+	// sections.
+	header string
+	body   []*line
+	// added is set for sections that did not exist when the File was parsed.
+	added bool
+}
+
+// Key is a single "name = value" entry within a Section. Keys that are
+// followed by indented lines, such as the AWS CLI "s3" settings, expose those
+// lines as Nested keys.
+type Key struct {
+	Name   string
+	Value  string
+	Nested []*Key
+
+	// raw holds the original lines of the key (including indented
+	// continuation lines), or nil when the key was created or changed and
+	// needs to be rendered.
+	raw []string
+}
+
+// line is either a key entry or a raw line (blank or comment) in a Section
+// body.
+type line struct {
+	key *Key
+	raw string
+}
+
+// LoadFile will read and parse the specific filename. A missing file is
+// treated as an empty File, so it can be created by saving it.
+func LoadFile(filename string) (*File, error) {
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return ParseFile(nil), nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", filename)
+	}
+
+	return ParseFile(data), nil
+}
+
+// ParseFile will parse data in the AWS config file format. Lines that cannot be
+// understood are kept verbatim so they survive a round trip.
+func ParseFile(data []byte) *File {
+
+	f := &File{newline: "\n", trailingNewline: true}
+
+	content := string(data)
+	if strings.Contains(content, "\r\n") {
+		f.newline = "\r\n"
+		content = strings.Replace(content, "\r\n", "\n", -1)
+	}
+	if content == "" {
+		return f
+	}
+	f.trailingNewline = strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var (
+		current *Section
+		last    *Key
+	)
+	for _, text := range lines {
+		trimmed := strings.TrimSpace(text)
+
+		if name, ok := parseHeader(trimmed); ok {
+			section := &Section{name: name, header: text}
+			// Claim the comments directly above the header.
+			if current == nil {
+				section.leading, f.preamble = splitLeading(f.preamble)
+			} else {
+				var leading []*line
+				leading, current.body = splitLeadingLines(current.body)
+				for _, l := range leading {
+					section.leading = append(section.leading, l.raw)
+				}
+			}
+			f.sections = append(f.sections, section)
+			current, last = section, nil
+			continue
+		}
+
+		if current == nil {
+			f.preamble = append(f.preamble, text)
+			continue
+		}
+
+		switch {
+		case trimmed == "" || isComment(trimmed):
+			current.body = append(current.body, &line{raw: text})
+			last = nil
+		case isIndented(text) && last != nil:
+			// Indented lines following a key are continuation lines or
+			// nested sub-settings of that key.
+			last.raw = append(last.raw, text)
+			if name, value, ok := parseKey(trimmed); ok {
+				last.Nested = append(last.Nested, &Key{Name: name, Value: value, raw: []string{text}})
+			}
+		default:
+			name, value, ok := parseKey(trimmed)
+			if !ok {
+				current.body = append(current.body, &line{raw: text})
+				last = nil
+				continue
+			}
+			last = &Key{Name: name, Value: value, raw: []string{text}}
+			current.body = append(current.body, &line{key: last})
+		}
+	}
+
+	return f
+}
+
+// parseHeader returns the section name of a "[name]" line.
+func parseHeader(trimmed string) (string, bool) {
+	if !strings.HasPrefix(trimmed, "[") || !strings.HasSuffix(trimmed, "]") {
+		return "", false
+	}
+	return strings.Join(strings.Fields(trimmed[1:len(trimmed)-1]), " "), true
+}
+
+// parseKey splits a "name = value" line.
+func parseKey(trimmed string) (string, string, bool) {
+	i := strings.Index(trimmed, "=")
+	if i <= 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(trimmed[:i]), strings.TrimSpace(trimmed[i+1:]), true
+}
+
+func isComment(trimmed string) bool {
+	return strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";")
+}
+
+func isIndented(text string) bool {
+	return strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")
+}
+
+// splitLeading splits the trailing run of comment lines off of lines.
+func splitLeading(lines []string) ([]string, []string) {
+	i := len(lines)
+	for i > 0 && isComment(strings.TrimSpace(lines[i-1])) {
+		i--
+	}
+	return append([]string(nil), lines[i:]...), lines[:i]
+}
+
+// splitLeadingLines splits the trailing run of comment lines off of a Section
+// body.
+func splitLeadingLines(body []*line) ([]*line, []*line) {
+	i := len(body)
+	for i > 0 && body[i-1].key == nil && isComment(strings.TrimSpace(body[i-1].raw)) {
+		i--
+	}
+	return append([]*line(nil), body[i:]...), body[:i]
+}
+
+// Sections returns every section of the File in order.
+func (f *File) Sections() []*Section {
+	return f.sections
+}
+
+// SectionStrings returns the names of every section of the File in order.
+func (f *File) SectionStrings() []string {
+	names := make([]string, 0, len(f.sections))
+	for _, s := range f.sections {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// Section returns the first section with the specific name, or nil if it does
+// not exist. The read-only methods of a nil Section behave like an empty
+// section, so lookups can be chained safely.
+func (f *File) Section(name string) *Section {
+	for _, s := range f.sections {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// HasSection reports whether the File contains a section with the specific
+// name.
+func (f *File) HasSection(name string) bool {
+	return f.Section(name) != nil
+}
+
+// NewSection will append a new, empty section to the end of the File. It fails
+// if the section already exists.
+func (f *File) NewSection(name string) (*Section, error) {
+	if f.HasSection(name) {
+		return nil, errors.Errorf("section %q already exists", name)
+	}
+	s := &Section{name: name, added: true}
+	f.sections = append(f.sections, s)
+	return s, nil
+}
+
+// EnsureSection returns the section with the specific name, appending a new
+// section if it does not exist yet.
+func (f *File) EnsureSection(name string) *Section {
+	if s := f.Section(name); s != nil {
+		return s
+	}
+	s, _ := f.NewSection(name)
+	return s
+}
+
+// DeleteSection removes every section with the specific name, together with
+// its leading comments. It reports whether anything was removed.
+func (f *File) DeleteSection(name string) bool {
+	var (
+		kept    []*Section
+		deleted bool
+	)
+	for _, s := range f.sections {
+		if s.name == name {
+			deleted = true
+			continue
+		}
+		kept = append(kept, s)
+	}
+	f.sections = kept
+	return deleted
+}
+
+// RenameSection renames the section oldName to newName in place. It fails if
+// oldName does not exist or newName already exists.
+func (f *File) RenameSection(oldName, newName string) error {
+	s := f.Section(oldName)
+	if s == nil {
+		return errors.Errorf("section %q does not exist", oldName)
+	}
+	if f.HasSection(newName) {
+		return errors.Errorf("section %q already exists", newName)
+	}
+	s.name = newName
+	s.header = ""
+	return nil
+}
+
+// CopySection appends a copy of the section src named dst, including its keys
+// and comments. It fails if src does not exist or dst already exists.
+func (f *File) CopySection(src, dst string) error {
+	s := f.Section(src)
+	if s == nil {
+		return errors.Errorf("section %q does not exist", src)
+	}
+	c, err := f.NewSection(dst)
+	if err != nil {
+		return err
+	}
+	c.leading = append([]string(nil), s.leading...)
+	for _, l := range s.body {
+		if l.key != nil {
+			c.body = append(c.body, &line{key: l.key.copy()})
+			continue
+		}
+		c.body = append(c.body, &line{raw: l.raw})
+	}
+	return nil
+}
+
+// Bytes renders the File, including any changes.
+func (f *File) Bytes() []byte {
+	var lines []string
+	lines = append(lines, f.preamble...)
+	for _, s := range f.sections {
+		// Keep new sections visually separated from the previous content.
+		if s.added && len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, s.lines()...)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(lines, f.newline))
+	if f.trailingNewline {
+		buf.WriteString(f.newline)
+	}
+	return buf.Bytes()
+}
+
+// SaveTo will write the File to the specific filename. The content is written
+// to a temporary file first and then renamed, so a failure never leaves a
+// partially written file behind. The mode of an existing file is kept, and a
+// symlinked file is written through to its target instead of being replaced.
+func (f *File) SaveTo(filename string) error {
+
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to resolve %s", filename)
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	directory := filepath.Dir(filename)
+	tmp, err := ioutil.TempFile(directory, fmt.Sprintf(".%s.", filepath.Base(filename)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temporary file in %s", directory)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(f.Bytes()); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to write %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close %s", tmp.Name())
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return errors.Wrapf(err, "failed to set mode of %s", tmp.Name())
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", filename)
+	}
+
+	return nil
+}
+
+// Name returns the name of the section.
+func (s *Section) Name() string {
+	if s == nil {
+		return ""
+	}
+	return s.name
+}
+
+// Keys returns every key of the section in order.
+func (s *Section) Keys() []*Key {
+	if s == nil {
+		return nil
+	}
+	var keys []*Key
+	for _, l := range s.body {
+		if l.key != nil {
+			keys = append(keys, l.key)
+		}
+	}
+	return keys
+}
+
+// KeyStrings returns the names of every key of the section in order.
+func (s *Section) KeyStrings() []string {
+	var names []string
+	for _, k := range s.Keys() {
+		names = append(names, k.Name)
+	}
+	return names
+}
+
+// Key returns the first key with the specific name, or nil if it does not
+// exist.
+func (s *Section) Key(name string) *Key {
+	if s == nil {
+		return nil
+	}
+	for _, l := range s.body {
+		if l.key != nil && l.key.Name == name {
+			return l.key
+		}
+	}
+	return nil
+}
+
+// HasKey reports whether the section contains a key with the specific name.
+func (s *Section) HasKey(name string) bool {
+	return s.Key(name) != nil
+}
+
+// Value returns the value of the specific key, or an empty string if it does
+// not exist.
+func (s *Section) Value(name string) string {
+	if k := s.Key(name); k != nil {
+		return k.Value
+	}
+	return ""
+}
+
+// SetValue sets the value of the specific key. An existing key is rewritten in
+// place (dropping any nested sub-settings), otherwise the key is added after
+// the last key of the section. Setting a key to its current value is a no-op,
+// so its formatting is preserved.
+func (s *Section) SetValue(name, value string) {
+	if k := s.Key(name); k != nil {
+		if k.Value == value && len(k.Nested) == 0 {
+			return
+		}
+		k.Value, k.Nested, k.raw = value, nil, nil
+		return
+	}
+	s.insert(&Key{Name: name, Value: value})
+}
+
+// SetKey copies k, including its nested sub-settings and original formatting,
+// into the section, replacing any existing key with the same name.
+func (s *Section) SetKey(k *Key) {
+	c := k.copy()
+	for _, l := range s.body {
+		if l.key != nil && l.key.Name == k.Name {
+			if l.key.equal(k) {
+				return
+			}
+			l.key = c
+			return
+		}
+	}
+	s.insert(c)
+}
+
+// DeleteKey removes every key with the specific name, together with its
+// nested sub-settings. It reports whether anything was removed.
+func (s *Section) DeleteKey(name string) bool {
+	var (
+		kept    []*line
+		deleted bool
+	)
+	for _, l := range s.body {
+		if l.key != nil && l.key.Name == name {
+			deleted = true
+			continue
+		}
+		kept = append(kept, l)
+	}
+	s.body = kept
+	return deleted
+}
+
+// insert adds k directly after the last key of the section, so trailing blank
+// lines and comments keep separating it from the next section.
+func (s *Section) insert(k *Key) {
+	i := 0
+	for j, l := range s.body {
+		if l.key != nil {
+			i = j + 1
+		}
+	}
+	s.body = append(s.body, nil)
+	copy(s.body[i+1:], s.body[i:])
+	s.body[i] = &line{key: k}
+}
+
+// lines renders the section.
+func (s *Section) lines() []string {
+	lines := append([]string(nil), s.leading...)
+	if s.header != "" {
+		lines = append(lines, s.header)
+	} else {
+		lines = append(lines, fmt.Sprintf("[%s]", s.name))
+	}
+	for _, l := range s.body {
+		if l.key != nil {
+			lines = append(lines, l.key.lines()...)
+			continue
+		}
+		lines = append(lines, l.raw)
+	}
+	return lines
+}
+
+// lines renders the key.
+func (k *Key) lines() []string {
+	if k.raw != nil {
+		return k.raw
+	}
+	lines := []string{fmt.Sprintf("%s = %s", k.Name, k.Value)}
+	if k.Value == "" {
+		lines[0] = fmt.Sprintf("%s =", k.Name)
+	}
+	for _, n := range k.Nested {
+		lines = append(lines, fmt.Sprintf("  %s = %s", n.Name, n.Value))
+	}
+	return lines
+}
+
+// copy returns a deep copy of the key.
+func (k *Key) copy() *Key {
+	c := &Key{Name: k.Name, Value: k.Value}
+	if k.raw != nil {
+		c.raw = append([]string(nil), k.raw...)
+	}
+	for _, n := range k.Nested {
+		c.Nested = append(c.Nested, n.copy())
+	}
+	return c
+}
+
+// equal reports whether k and o hold the same value and nested sub-settings.
+func (k *Key) equal(o *Key) bool {
+	if k.Name != o.Name || k.Value != o.Value || len(k.Nested) != len(o.Nested) {
+		return false
+	}
+	for i := range k.Nested {
+		if !k.Nested[i].equal(o.Nested[i]) {
+			return false
+		}
+	}
+	return true
+}
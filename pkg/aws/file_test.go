@@ -0,0 +1,139 @@
+package aws
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readTestdata returns the contents of a file in testdata/file.
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "file", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	in := readTestdata(t, "config.in")
+
+	if out := ParseFile(in).Bytes(); !bytes.Equal(out, in) {
+		t.Errorf("unchanged file was rewritten:\n%s", out)
+	}
+
+	crlf := bytes.Replace(in, []byte("\n"), []byte("\r\n"), -1)
+	if out := ParseFile(crlf).Bytes(); !bytes.Equal(out, crlf) {
+		t.Errorf("unchanged CRLF file was rewritten:\n%q", out)
+	}
+
+	noNewline := bytes.TrimSuffix(in, []byte("\n"))
+	if out := ParseFile(noNewline).Bytes(); !bytes.Equal(out, noNewline) {
+		t.Errorf("missing trailing newline was added:\n%q", out)
+	}
+}
+
+func TestFileNested(t *testing.T) {
+	f := ParseFile(readTestdata(t, "config.in"))
+
+	s3 := f.Section("default").Key("s3")
+	if s3 == nil || len(s3.Nested) != 2 {
+		t.Fatalf("nested keys of s3 = %+v", s3)
+	}
+	if s3.Nested[0].Name != "max_concurrent_requests" || s3.Nested[0].Value != "20" {
+		t.Errorf("first nested key = %s = %s", s3.Nested[0].Name, s3.Nested[0].Value)
+	}
+	if got := f.Section("profile prod").Value("unknown_tool_setting"); got != "keep me" {
+		t.Errorf("unknown key = %q", got)
+	}
+}
+
+func TestFileEdit(t *testing.T) {
+	f := ParseFile(readTestdata(t, "config.in"))
+
+	f.Section("default").SetValue("region", "eu-central-1")
+	// Setting a key to its current value keeps its formatting.
+	f.Section("profile prod").SetValue("region", "us-east-1")
+	f.Section("profile prod").SetValue("duration_seconds", "3600")
+	if err := f.RenameSection("profile prod", "profile production"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.DeleteSection("profile legacy") {
+		t.Fatal("profile legacy was not deleted")
+	}
+	s, err := f.NewSection("profile production-mfa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetValue("region", "us-east-1")
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "config")
+	if err = f.SaveTo(filename); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golden := readTestdata(t, "config.golden"); !bytes.Equal(out, golden) {
+		t.Errorf("saved file differs from config.golden:\n%s", out)
+	}
+}
+
+func TestFileSaveToSymlink(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	target := filepath.Join(dir, "dotfiles-config")
+	if err := ioutil.WriteFile(target, []byte("[default]\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+
+	f, err := LoadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Section("default").SetValue("region", "eu-west-1")
+	if err = f.SaveTo(link); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("symlink was replaced by a regular file")
+	}
+	if info, err = os.Stat(target); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("mode of the target = %v, %v", info.Mode().Perm(), err)
+	}
+	if b, _ := ioutil.ReadFile(target); string(b) != "[default]\nregion = eu-west-1\n" {
+		t.Errorf("target = %q", b)
+	}
+}
+
+func TestNilSection(t *testing.T) {
+	s := ParseFile(nil).Section("missing")
+	if s.Name() != "" || s.Keys() != nil || s.Value("region") != "" || s.HasKey("region") {
+		t.Error("nil section does not behave like an empty section")
+	}
+}
+
+// tempDir returns a temporary directory and a function that removes it.
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "awsctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
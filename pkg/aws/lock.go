@@ -0,0 +1,70 @@
+package aws
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lockRetryInterval is how often a lock that is held by another process is
+// tried again.
+const lockRetryInterval = 50 * time.Millisecond
+
+// ErrLockUnsupported is returned by LockFile on platforms without file locks.
+var ErrLockUnsupported = errors.New("locking files is not supported on this platform")
+
+// FileLock is an advisory, exclusive lock on a lock file, which awsctl
+// processes take before they change the AWS files. The lock file itself is
+// left in place once the lock is released.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile takes the lock on filename, creating the file if needed. It waits
+// for other processes holding the lock for at most timeout.
+func LockFile(filename string, timeout time.Duration) (*FileLock, error) {
+	directory := filepath.Dir(filename)
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return nil, fileError(err, "failed to make directory: "+directory)
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fileError(err, "failed to open lock file")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(file)
+		if err == ErrLockUnsupported {
+			file.Close()
+			return nil, err
+		}
+		if err != nil {
+			file.Close()
+			return nil, fileError(err, "failed to lock "+filename)
+		}
+		if locked {
+			return &FileLock{file: file}, nil
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, &Error{
+				Kind: ErrorLockTimeout,
+				Err:  errors.Errorf("timed out after %s waiting for another awsctl process to release %s", timeout, filename),
+			}
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	if err := unlock(l.file); err != nil {
+		l.file.Close()
+		return fileError(err, "failed to unlock "+l.file.Name())
+	}
+	return l.file.Close()
+}
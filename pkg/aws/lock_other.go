@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package aws
+
+import "os"
+
+// tryLock fails with ErrLockUnsupported, there is no flock on this platform,
+// e.g. AIX or Plan 9.
+func tryLock(file *os.File) (bool, error) {
+	return false, ErrLockUnsupported
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
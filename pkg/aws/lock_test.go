@@ -0,0 +1,110 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || windows
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris windows
+
+package aws
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFileTimeout(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "aws", "credentials.lock")
+
+	lock, err := LockFile(filename, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	start := time.Now()
+	_, err = LockFile(filename, 100*time.Millisecond)
+	if KindOf(err) != ErrorLockTimeout {
+		t.Fatalf("got error %v, want %s", err, ErrorLockTimeout)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("gave up after %s, before the timeout", waited)
+	}
+	if want := "timed out after 100ms waiting for another awsctl process to release " + filename; err.Error() != want {
+		t.Errorf("got error %q, want %q", err, want)
+	}
+}
+
+func TestLockFileWaits(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	filename := filepath.Join(dir, "credentials.lock")
+
+	lock, err := LockFile(filename, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		second, err := LockFile(filename, 5*time.Second)
+		if err == nil {
+			err = second.Unlock()
+		}
+		locked <- err
+	}()
+
+	select {
+	case err = <-locked:
+		t.Fatalf("lock was taken twice: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err = lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-locked; err != nil {
+		t.Errorf("lock was not taken once it was released: %s", err)
+	}
+}
+
+func TestLockStoreKeepsUpdates(t *testing.T) {
+	store, cleanup := openTestStore(t, "[profile counter]\ncount = 0\n", "")
+	defer cleanup()
+
+	const writers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locked, err := LockStore(store.configFile, store.credentialsFile, 10*time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer locked.Unlock()
+
+			section := locked.Config.Section("profile counter")
+			count, _ := strconv.Atoi(section.Value("count"))
+			section.SetValue("count", strconv.Itoa(count+1))
+			if err = locked.Save(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	saved, err := OpenStore(store.configFile, store.credentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := saved.Config.Section("profile counter").Value("count"); count != strconv.Itoa(writers) {
+		t.Errorf("count = %s, want %d, updates were lost", count, writers)
+	}
+}
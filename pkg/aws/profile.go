@@ -1,15 +1,14 @@
 package aws
 
 import (
-	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/pkg/errors"
-	ini "gopkg.in/ini.v1"
 )
 
 const (
@@ -21,42 +20,72 @@ const (
 	keyAuthenticationExpiration = "authentication_expiration"
 )
 
+// mfaToken matches the one time codes of MFA devices.
+var mfaToken = regexp.MustCompile(`^\d{6}$`)
+
 // Profile represents a structure that includes authentication fields necessary
-// to authenticate with AWS.
+// to authenticate with AWS, along with the rest of the settings of an AWS CLI
+// profile.
 type Profile struct {
-	Name                     string `ini:"-"`
-	AccessKeyID              string `ini:"aws_access_key_id,omitempty"`
-	SecretAccessKey          string `ini:"aws_secret_access_key,omitempty"`
-	SessionToken             string `ini:"aws_session_token,omitempty"`
-	MFASerial                string `ini:"mfa_serial,omitempty"`
-	Region                   string `ini:"region,omitempty"`
-	AuthenticationExpiration string `ini:"authentication_expiration,omitempty"`
+	// Name is the name of the profile, without any "profile " prefix.
+	Name                     string
+	AccessKeyID              string
+	SecretAccessKey          string
+	SessionToken             string
+	MFASerial                string
+	Region                   string
+	Output                   string
+	STSRegionalEndpoints     string
+	STSEndpointURL           string
+	RoleARN                  string
+	SourceProfile            string
+	ExternalID               string
+	DurationSeconds          int64
+	CredentialProcess        string
+	SSOSession               string
+	SSOStartURL              string
+	SSORegion                string
+	SSOAccountID             string
+	SSORoleName              string
+	AuthenticationExpiration string
+	// Extra holds every key that is not modeled above, such as "cli_pager" or
+	// "s3".
+	Extra map[string]string
+}
+
+// IsRole reports whether the profile assumes a role.
+func (p Profile) IsRole() bool {
+	return p.RoleARN != ""
+}
+
+// IsSSO reports whether the profile is backed by AWS IAM Identity Center.
+func (p Profile) IsSSO() bool {
+	return p.SSOSession != "" || p.SSOStartURL != ""
 }
 
 // ReadConfigFile will read the specific filename and parse the file
-// specifically for AWS config file formats and return a list of Profiles.
+// specifically for AWS config file formats and return a list of Profiles. A
+// missing file is treated as a file without any profiles. Only "[default]"
+// and "[profile NAME]" sections are returned, with the prefix stripped from
+// the name.
 func ReadConfigFile(filename string) ([]Profile, error) {
 
-	file, err := ini.Load(filename)
+	file, err := LoadFile(filename)
 	if err != nil {
 		return []Profile{}, errors.Wrap(err, "failed to read config file")
 	}
 
-	sections := file.SectionStrings()
 	var profiles []Profile
-	for _, section := range sections {
-		// Skip the "DEFAULT" ini section header.
-		if section == "DEFAULT" {
+	for _, section := range file.Sections() {
+		kind, name := ParseConfigSection(section.Name())
+		if kind != SectionProfile {
 			continue
 		}
-		var profile Profile
 
-		if err = file.Section(section).MapTo(&profile); err != nil {
+		profile, err := parseProfile(name, section)
+		if err != nil {
 			return []Profile{}, err
 		}
-
-		// Add the section header's name to the Profile.
-		profile.Name = section
 		profiles = append(profiles, profile)
 	}
 
@@ -65,10 +94,29 @@ func ReadConfigFile(filename string) ([]Profile, error) {
 
 // Authenticate will establish a set of temporary AWS credentials for the
 // specific duration. The serialNumber and token are linked to the MFA device
-// that is connected to the AWS profile/account.
-func Authenticate(duration int64, serialNumber, token string) (Profile, error) {
+// that is connected to the AWS profile/account. The request is signed with the
+// keys of the base profile and sent to the STS endpoint described by
+// stsConfig.
+func Authenticate(stsConfig STSConfig, base Profile, duration int64, serialNumber, token string) (Profile, error) {
+
+	if !mfaToken.MatchString(token) {
+		return Profile{}, &Error{Kind: ErrorInvalidMFAToken, Err: errors.New("MFA token must be a 6 digit code")}
+	}
+
+	if err := validateMFAPartition(serialNumber, stsConfig.Region); err != nil {
+		return Profile{}, err
+	}
+
+	if base.AccessKeyID == "" || base.SecretAccessKey == "" {
+		return Profile{}, errors.Errorf("profile %s has no access keys to authenticate with", base.Name)
+	}
+
+	creds := credentials.NewStaticCredentials(base.AccessKeyID, base.SecretAccessKey, "")
+	svc, err := stsConfig.client(creds)
+	if err != nil {
+		return Profile{}, err
+	}
 
-	svc := sts.New(session.New())
 	input := &sts.GetSessionTokenInput{
 		DurationSeconds: aws.Int64(duration),
 		SerialNumber:    aws.String(serialNumber),
@@ -77,15 +125,16 @@ func Authenticate(duration int64, serialNumber, token string) (Profile, error) {
 
 	result, err := svc.GetSessionToken(input)
 	if err != nil {
-		return Profile{}, errors.Wrap(err, "get session token failed")
+		return Profile{}, requestError(err, "get session token failed")
 	}
 
-	currentTime := time.Now()
-	addedDuration, err := time.ParseDuration(fmt.Sprintf("%vs", duration))
-	if err != nil {
-		return Profile{}, errors.Wrap(err, "parse duration failed")
+	// Prefer the expiration STS granted over the requested duration, which STS
+	// may have shortened.
+	expiration := time.Now().Add(time.Duration(duration) * time.Second)
+	if result.Credentials.Expiration != nil {
+		expiration = *result.Credentials.Expiration
 	}
-	authenticationExpiration := currentTime.Add(time.Duration(addedDuration)).Format(time.RFC3339)
+	authenticationExpiration := expiration.Format(time.RFC3339)
 
 	return Profile{
 		AccessKeyID:              *result.Credentials.AccessKeyId,
@@ -97,120 +146,340 @@ func Authenticate(duration int64, serialNumber, token string) (Profile, error) {
 }
 
 // NewProfile will return a new profile based on parameters that are passed in.
-func NewProfile(profile, region, serialNumber, accessKeyID, secretAccessKey string) (Profile, error) {
+// Unless allowUnknownRegion is set, the region must be known to LookupRegion.
+func NewProfile(profile, region, serialNumber, accessKeyID, secretAccessKey string, allowUnknownRegion bool) (Profile, error) {
 
-	if profile == "" {
-		return Profile{}, errors.New("profile name must be set")
-	}
-	if region == "" {
-		return Profile{}, errors.New("region must be set")
-	}
-	if err := validateRegion(region); err != nil {
-		return Profile{}, err
-	}
-	if serialNumber == "" {
-		return Profile{}, errors.New("serial number must be set")
-	}
-	if accessKeyID == "" {
-		return Profile{}, errors.New("access key must be set")
-	}
-	if secretAccessKey == "" {
-		return Profile{}, errors.New("secret key must be set")
-	}
-	return Profile{
+	p := Profile{
 		Name:            profile,
 		Region:          region,
 		MFASerial:       serialNumber,
 		AccessKeyID:     accessKeyID,
 		SecretAccessKey: secretAccessKey,
-	}, nil
+	}
+	if err := p.Validate(); err != nil {
+		return Profile{}, err
+	}
+	if _, err := LookupRegion(region, allowUnknownRegion); err != nil {
+		return Profile{}, err
+	}
+	return p, nil
 }
 
-// validateRegion will examine whether or not the region is supported within
-// AWS. The list of regions here is based off of the EC2 supported standard
-// public offering.
-// See: https://docs.aws.amazon.com/general/latest/gr/rande.html#ec2_region.
-func validateRegion(region string) error {
-	regions := map[string]bool{
-		"us-east-2":      true,
-		"us-east-1":      true,
-		"us-west-1":      true,
-		"us-west-2":      true,
-		"ap-south-1":     true,
-		"ap-northeast-3": true,
-		"ap-northeast-2": true,
-		"ap-southeast-1": true,
-		"ap-southeast-2": true,
-		"ap-northeast-1": true,
-		"ca-central-1":   true,
-		"cn-north-1":     true,
-		"cn-northwest-1": true,
-		"eu-central-1":   true,
-		"eu-west-1":      true,
-		"eu-west-2":      true,
-		"eu-west-3":      true,
-		"eu-north-1":     true,
-		"sa-east-1":      true,
-		"us-gov-east-1":  true,
-		"us-gov-west-1":  true,
-	}
-	if ok := regions[region]; !ok {
-		return errors.New("region is not supported in AWS. See: https://docs.aws.amazon.com/general/latest/gr/rande.html#ec2_region")
+// Validate will ensure that every setting a base profile needs is set. It does
+// not look up the region, see LookupRegion.
+func (p Profile) Validate() error {
+
+	if p.Name == "" {
+		return errors.New("profile name must be set")
+	}
+	if p.Region == "" {
+		return errors.New("region must be set")
+	}
+	if p.MFASerial == "" {
+		return errors.New("serial number must be set")
+	}
+	if p.AccessKeyID == "" {
+		return errors.New("access key must be set")
+	}
+	if p.SecretAccessKey == "" {
+		return errors.New("secret key must be set")
 	}
 	return nil
 }
 
 // Save will persist the Profile's information to their respective places.
-func (p Profile) Save(config, credentials *ini.File, configFile, credentialsFile string) error {
-
-	profile := fmt.Sprintf("profile %s", p.Name)
+func (p Profile) Save(store *Store) error {
 
-	configSection, err := config.NewSection(profile)
+	configSection, err := store.Config.NewSection(ConfigSection(p.Name))
 	if err != nil {
 		return errors.Wrap(err, "failed to create new config section")
 	}
-	configSection.Key(keyRegion).SetValue(p.Region)
-	configSection.Key(keyMFASerial).SetValue(p.MFASerial)
-	if err = config.SaveTo(configFile); err != nil {
-		return errors.Wrap(err, "failed to save new config file")
-	}
+	configSection.SetValue(keyRegion, p.Region)
+	configSection.SetValue(keyMFASerial, p.MFASerial)
 
-	credentialsSection, err := credentials.NewSection(profile)
+	credentialsSection, err := store.Credentials.NewSection(CredentialsSection(p.Name))
 	if err != nil {
 		return errors.Wrap(err, "failed to create new credentials section")
 	}
-	credentialsSection.Key(keyAccessKeyID).SetValue(p.AccessKeyID)
-	credentialsSection.Key(keySecretAccessKey).SetValue(p.SecretAccessKey)
-	credentialsSection.Key(keyAuthenticationExpiration).SetValue(p.AuthenticationExpiration)
-	if err := credentials.SaveTo(credentialsFile); err != nil {
-		return errors.Wrap(err, "failed to save new credentials file")
+	credentialsSection.SetValue(keyAccessKeyID, p.AccessKeyID)
+	credentialsSection.SetValue(keySecretAccessKey, p.SecretAccessKey)
+	if p.AuthenticationExpiration != "" {
+		credentialsSection.SetValue(keyAuthenticationExpiration, p.AuthenticationExpiration)
+	}
+
+	return store.Save()
+}
+
+// Update will persist the Profile's information to their respective places,
+// overwriting the region, MFA serial and keys of an existing profile. Every
+// other setting of the profile is kept as is, and the settings of its session
+// profiles are synced with the updated ones.
+func (p Profile) Update(store *Store) error {
+
+	configSection := store.Config.EnsureSection(ConfigSection(p.Name))
+	configSection.SetValue(keyRegion, p.Region)
+	configSection.SetValue(keyMFASerial, p.MFASerial)
+
+	credentialsSection := store.Credentials.EnsureSection(CredentialsSection(p.Name))
+	credentialsSection.SetValue(keyAccessKeyID, p.AccessKeyID)
+	credentialsSection.SetValue(keySecretAccessKey, p.SecretAccessKey)
+
+	for _, session := range store.SessionsOf(p.Name) {
+		if err := store.SyncSessionConfig(p.Name, session); err != nil {
+			return err
+		}
+	}
+
+	return store.Save()
+}
+
+// Removal describes a profile that is about to be removed, together with its
+// session profiles.
+type Removal struct {
+	Profile  string
+	Sessions []string
+	// DependencyOf is set when the profile is only removed because its
+	// source_profile is removed as well.
+	DependencyOf string
+}
+
+// PlanRemoval resolves everything that has to be removed together with the
+// specific profiles: their session profiles and, when cascade is set, every
+// role profile that depends on them through "source_profile". Without cascade
+// such dependent profiles block the removal.
+func PlanRemoval(profiles []string, cascade bool, store *Store) ([]Removal, error) {
+
+	var (
+		removals []Removal
+		planned  = map[string]bool{}
+	)
+	var plan func(profile, dependencyOf string) error
+	plan = func(profile, dependencyOf string) error {
+		if planned[profile] {
+			return nil
+		}
+		if !store.HasProfile(profile) {
+			return ProfileNotFoundError(profile)
+		}
+		planned[profile] = true
+		removals = append(removals, Removal{
+			Profile:      profile,
+			Sessions:     store.SessionsOf(profile),
+			DependencyOf: dependencyOf,
+		})
+
+		for _, dependent := range store.Dependents(profile) {
+			if planned[dependent] {
+				continue
+			}
+			if !cascade && !contains(profiles, dependent) {
+				return errors.Errorf("profile %s is the source_profile of %s, remove it as well or use --cascade", profile, dependent)
+			}
+			if err := plan(dependent, profile); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, profile := range profiles {
+		if err := plan(profile, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return removals, nil
+}
+
+// RemoveProfiles will remove the profile and session sections of every
+// Removal from each AWS config and credentials file (if possible).
+func RemoveProfiles(removals []Removal, store *Store) error {
+
+	var removed bool
+	for _, r := range removals {
+		for _, profile := range append([]string{r.Profile}, r.Sessions...) {
+			if removeSections(profile, store) {
+				removed = true
+			}
+		}
+	}
+
+	if !removed {
+		return nil
+	}
+	return store.Save()
+}
+
+// RemoveProfile will remove the profile section, as well as its session
+// profiles, from each AWS config and credentials file (if possible).
+func RemoveProfile(profile string, store *Store) error {
+
+	removals, err := PlanRemoval([]string{profile}, false, store)
+	if err != nil {
+		return err
+	}
+
+	return RemoveProfiles(removals, store)
+}
+
+// removeSections deletes the sections of a single profile and reports whether
+// anything was deleted.
+func removeSections(profile string, store *Store) bool {
+
+	removed := store.Config.DeleteSection(ConfigSection(profile))
+
+	if store.Credentials.DeleteSection(CredentialsSection(profile)) {
+		removed = true
+	}
+
+	// Older versions of awsctl saved credentials under a "profile " prefixed
+	// section as well.
+	if store.Credentials.DeleteSection(prefixProfile + profile) {
+		removed = true
+	}
+
+	return removed
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
+}
 
+// validateProfileName ensures name can be used as a section header.
+func validateProfileName(name string) error {
+	if name == "" {
+		return errors.New("profile name must be set")
+	}
+	if strings.ContainsAny(name, "[] \t\r\n") {
+		return errors.Errorf("invalid profile name: %q", name)
+	}
 	return nil
 }
 
-// RemoveProfile will remove the profile section from each AWS config and
-// credentials file (if possible).
-func RemoveProfile(profile string, config, credentials *ini.File, configFile, credentialsFile string) error {
+// RenameProfile will rename the profile oldName to newName within both the AWS
+// config and credentials files, together with its freshest session profile,
+// which is renamed according to templates. Any other session profiles of
+// oldName would collide with it and are removed; their names are returned.
+// Every "source_profile" reference to oldName is updated as well; the names of
+// the updated profiles are returned.
+func RenameProfile(oldName, newName string, templates SessionTemplates, store *Store) (updated, removed []string, err error) {
+
+	if err = checkProfileTransfer(oldName, newName, store); err != nil {
+		return nil, nil, err
+	}
+
+	session, stale := store.freshestSession(store.SessionsOf(oldName), "")
+	if err = renameSections(store, oldName, newName); err != nil {
+		return nil, nil, err
+	}
+
+	for _, profile := range stale {
+		removeSections(profile, store)
+		removed = append(removed, profile)
+	}
+
+	if session != "" {
+		target, err := store.SessionProfile(newName, templates)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = renameSections(store, session, target); err != nil {
+			return nil, nil, err
+		}
+		markSession(store, target, newName)
+	}
+
+	for _, section := range store.Config.Sections() {
+		kind, name := ParseConfigSection(section.Name())
+		if kind == SectionProfile && section.Value(keySourceProfile) == oldName {
+			section.SetValue(keySourceProfile, newName)
+			updated = append(updated, name)
+		}
+	}
+
+	return updated, removed, store.Save()
+}
+
+// CloneProfile will copy the profile src to dst within both the AWS config and
+// credentials files, together with its freshest session profile, which is
+// named according to templates. Any other session profiles of src are left
+// alone.
+func CloneProfile(src, dst string, templates SessionTemplates, store *Store) error {
+
+	if err := checkProfileTransfer(src, dst, store); err != nil {
+		return err
+	}
+
+	session, _ := store.freshestSession(store.SessionsOf(src), "")
+	if err := copySections(store, src, dst); err != nil {
+		return err
+	}
 
-	if _, err := config.GetSection(profile); err == nil {
-		config.DeleteSection(profile)
-		if err := config.SaveTo(configFile); err != nil {
-			return errors.Wrap(err, "failed to save new config file")
+	if session != "" {
+		target, err := store.SessionProfile(dst, templates)
+		if err != nil {
+			return err
 		}
+		if err = copySections(store, session, target); err != nil {
+			return err
+		}
+		markSession(store, target, dst)
 	}
 
-	// Remove the "profile " prefix of the profile string if it exists.
-	// strings.TrimPrefix() will return the existing profile string if the
-	// prefix does not exist.
-	profile = strings.TrimPrefix(profile, "profile ")
+	return store.Save()
+}
+
+// checkProfileTransfer validates renaming or copying the profile src to dst.
+func checkProfileTransfer(src, dst string, store *Store) error {
+	if err := validateProfileName(dst); err != nil {
+		return err
+	}
+	if !store.HasProfile(src) {
+		return ProfileNotFoundError(src)
+	}
+	if store.HasProfile(dst) {
+		return ProfileExistsError(dst)
+	}
+	return nil
+}
 
-	if _, err := credentials.GetSection(profile); err == nil {
-		credentials.DeleteSection(profile)
-		if err := credentials.SaveTo(credentialsFile); err != nil {
-			return errors.Wrap(err, "failed to save new credentials file")
+// renameSections renames the config and credentials sections of a profile.
+func renameSections(store *Store, src, dst string) error {
+	if store.HasProfile(dst) {
+		return ProfileExistsError(dst)
+	}
+	if store.Config.HasSection(ConfigSection(src)) {
+		if err := store.Config.RenameSection(ConfigSection(src), ConfigSection(dst)); err != nil {
+			return err
+		}
+	}
+	if store.Credentials.HasSection(CredentialsSection(src)) {
+		if err := store.Credentials.RenameSection(CredentialsSection(src), CredentialsSection(dst)); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// copySections copies the config and credentials sections of a profile.
+func copySections(store *Store, src, dst string) error {
+	if store.HasProfile(dst) {
+		return ProfileExistsError(dst)
+	}
+	if store.Config.HasSection(ConfigSection(src)) {
+		if err := store.Config.CopySection(ConfigSection(src), ConfigSection(dst)); err != nil {
+			return err
+		}
+	}
+	if store.Credentials.HasSection(CredentialsSection(src)) {
+		if err := store.Credentials.CopySection(CredentialsSection(src), CredentialsSection(dst)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,312 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const getSessionTokenResponse = `<GetSessionTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetSessionTokenResult>
+    <Credentials>
+      <AccessKeyId>ASIASESSION</AccessKeyId>
+      <SecretAccessKey>session-secret</SecretAccessKey>
+      <SessionToken>session-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </GetSessionTokenResult>
+</GetSessionTokenResponse>`
+
+func TestAuthenticateSignsWithBaseKeys(t *testing.T) {
+	// The credentials of the environment must not be used.
+	for key, value := range map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENVIRONMENT", "AWS_SECRET_ACCESS_KEY": "environment"} {
+		old, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		if ok {
+			defer os.Setenv(key, old)
+		} else {
+			defer os.Unsetenv(key)
+		}
+	}
+
+	expiration := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprintf(w, getSessionTokenResponse, expiration.Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	base := Profile{Name: "cowboy", AccessKeyID: "AKIABASE", SecretAccessKey: "base-secret"}
+	config := STSConfig{Region: "us-east-1", EndpointURL: srv.URL}
+	session, err := Authenticate(config, base, 3600, "arn:aws:iam::123456789012:mfa/cowboy", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(authorization, "Credential=AKIABASE/") {
+		t.Errorf("request was not signed with the keys of the base profile: %s", authorization)
+	}
+	if session.AccessKeyID != "ASIASESSION" || session.SessionToken != "session-token" {
+		t.Errorf("got session %+v", session)
+	}
+	if got, ok := session.SessionExpiration(); !ok || !got.Equal(expiration) {
+		t.Errorf("got expiration %s, want %s", got, expiration)
+	}
+}
+
+func TestAuthenticateWithoutKeys(t *testing.T) {
+	config := STSConfig{Region: "us-east-1", EndpointURL: "http://127.0.0.1:1"}
+	if _, err := Authenticate(config, Profile{Name: "cowboy"}, 3600, "arn:aws:iam::123456789012:mfa/cowboy", "123456"); err == nil {
+		t.Error("authenticated without the keys of the base profile")
+	}
+}
+
+func TestNewProfile(t *testing.T) {
+	const serial = "arn:aws:iam::123456789012:mfa/cowboy"
+	tests := []struct {
+		name         string
+		profile      string
+		region       string
+		serial       string
+		accessKey    string
+		secretKey    string
+		allowUnknown bool
+		err          bool
+	}{
+		{"complete", "cowboy", "eu-west-1", serial, "AKIA", "secret", false, false},
+		{"no name", "", "eu-west-1", serial, "AKIA", "secret", false, true},
+		{"no region", "cowboy", "", serial, "AKIA", "secret", false, true},
+		{"no serial", "cowboy", "eu-west-1", "", "AKIA", "secret", false, true},
+		{"no access key", "cowboy", "eu-west-1", serial, "", "secret", false, true},
+		{"no secret key", "cowboy", "eu-west-1", serial, "AKIA", "", false, true},
+		{"misspelled region", "cowboy", "eu-wset-1", serial, "AKIA", "secret", false, true},
+		{"unknown region", "cowboy", "eu-future-9", serial, "AKIA", "secret", false, true},
+		{"allowed unknown region", "cowboy", "eu-future-9", serial, "AKIA", "secret", true, false},
+	}
+
+	for _, test := range tests {
+		p, err := NewProfile(test.profile, test.region, test.serial, test.accessKey, test.secretKey, test.allowUnknown)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && (p.Name != test.profile || p.Region != test.region || p.MFASerial != test.serial) {
+			t.Errorf("%s: got %+v", test.name, p)
+		}
+	}
+}
+
+func TestProfileUpdate(t *testing.T) {
+	store, cleanup := openTestStore(t, `# my profiles
+[profile cowboy]
+region = eu-west-1
+mfa_serial = arn:aws:iam::123456789012:mfa/cowboy
+output = json
+
+[profile cowboy_mfa]
+region = eu-west-1
+output = json
+awsctl_session_of = cowboy
+`, `[cowboy]
+aws_access_key_id = AKIAOLD
+aws_secret_access_key = old
+`)
+	defer cleanup()
+
+	p, err := store.Profile("cowboy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Region = "eu-central-1"
+	p.AccessKeyID, p.SecretAccessKey = "AKIANEW", "new"
+	if err = p.Update(store); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := OpenStore(store.configFile, store.credentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := saved.Profile("cowboy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Region != "eu-central-1" || got.AccessKeyID != "AKIANEW" || got.SecretAccessKey != "new" || got.Output != "json" {
+		t.Errorf("updated profile = %+v", got)
+	}
+	if region := saved.Config.Section("profile cowboy_mfa").Value("region"); region != "eu-central-1" {
+		t.Errorf("region of the session profile = %q, want it synced", region)
+	}
+	if !bytes.HasPrefix(saved.Config.Bytes(), []byte("# my profiles\n")) {
+		t.Error("comment of the config file was lost")
+	}
+}
+
+func TestInvalidateSessions(t *testing.T) {
+	store := newTestStore(`[profile cowboy]
+[profile cowboy_mfa]
+awsctl_session_of = cowboy
+[profile other_mfa]
+awsctl_session_of = other
+`, `[cowboy_mfa]
+aws_session_token = token
+awsctl_session_of = cowboy
+[other_mfa]
+aws_session_token = token
+awsctl_session_of = other
+`)
+
+	if got := store.InvalidateSessions("cowboy"); len(got) != 1 || got[0] != "cowboy_mfa" {
+		t.Errorf("InvalidateSessions() = %v", got)
+	}
+	if store.Credentials.HasSection("cowboy_mfa") || !store.Config.HasSection("profile cowboy_mfa") {
+		t.Error("credentials of the session were not removed, or its config was")
+	}
+	if !store.Credentials.HasSection("other_mfa") {
+		t.Error("session of another profile was invalidated")
+	}
+}
+
+// removalTestConfig has two base profiles, each with a session profile, and a
+// role profile that depends on one of them.
+const removalTestConfig = `[profile dev-a]
+[profile dev-a_mfa]
+awsctl_session_of = dev-a
+[profile dev-b]
+[profile dev-b_mfa]
+awsctl_session_of = dev-b
+[profile admin]
+role_arn = arn:aws:iam::123456789012:role/admin
+source_profile = dev-a
+[profile prod]
+`
+
+func TestMatchProfiles(t *testing.T) {
+	store := newTestStore(removalTestConfig, "")
+
+	tests := []struct {
+		patterns []string
+		want     []string
+		err      bool
+	}{
+		{[]string{"prod"}, []string{"prod"}, false},
+		{[]string{"dev-*"}, []string{"dev-a", "dev-b"}, false},
+		{[]string{"dev-?", "dev-a", "prod"}, []string{"dev-a", "dev-b", "prod"}, false},
+		// Session profiles are only matched by name.
+		{[]string{"*_mfa"}, nil, true},
+		{[]string{"dev-a_mfa"}, []string{"dev-a_mfa"}, false},
+		{[]string{"missing"}, nil, true},
+		{[]string{"test-*"}, nil, true},
+		{[]string{"[dev"}, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := store.MatchProfiles(test.patterns)
+		if (err != nil) != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MatchProfiles(%v) = %v, %v, want %v, error %v", test.patterns, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestPlanRemoval(t *testing.T) {
+	store := newTestStore(removalTestConfig, "")
+
+	tests := []struct {
+		name     string
+		profiles []string
+		cascade  bool
+		want     []Removal
+		err      bool
+	}{
+		{
+			name:     "with sessions",
+			profiles: []string{"dev-b"},
+			want:     []Removal{{Profile: "dev-b", Sessions: []string{"dev-b_mfa"}}},
+		},
+		{
+			name:     "dependent profile blocks the removal",
+			profiles: []string{"dev-a"},
+			err:      true,
+		},
+		{
+			name:     "dependent profile removed as well",
+			profiles: []string{"dev-a", "admin"},
+			want: []Removal{
+				{Profile: "dev-a", Sessions: []string{"dev-a_mfa"}},
+				{Profile: "admin", DependencyOf: "dev-a"},
+			},
+		},
+		{
+			name:     "cascade",
+			profiles: []string{"dev-a"},
+			cascade:  true,
+			want: []Removal{
+				{Profile: "dev-a", Sessions: []string{"dev-a_mfa"}},
+				{Profile: "admin", DependencyOf: "dev-a"},
+			},
+		},
+		{
+			name:     "duplicates",
+			profiles: []string{"prod", "prod"},
+			want:     []Removal{{Profile: "prod"}},
+		},
+		{
+			name:     "missing profile",
+			profiles: []string{"prod", "missing"},
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := PlanRemoval(test.profiles, test.cascade, store)
+		if (err != nil) != test.err || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: PlanRemoval(%v) = %+v, %v, want %+v, error %v", test.name, test.profiles, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestRemoveProfiles(t *testing.T) {
+	store, cleanup := openTestStore(t, removalTestConfig, `[dev-a]
+aws_access_key_id = AKIA
+[dev-a_mfa]
+aws_session_token = token
+[profile dev-a]
+aws_access_key_id = AKIALEGACY
+[prod]
+aws_access_key_id = AKIA
+`)
+	defer cleanup()
+
+	removals, err := PlanRemoval([]string{"dev-a"}, true, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RemoveProfiles(removals, store); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := OpenStore(store.configFile, store.credentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []string{"dev-a", "dev-a_mfa", "admin"} {
+		if saved.HasProfile(profile) {
+			t.Errorf("profile %s was not removed", profile)
+		}
+	}
+	if saved.Credentials.HasSection("profile dev-a") {
+		t.Error("legacy credentials section was not removed")
+	}
+	for _, profile := range []string{"dev-b", "dev-b_mfa", "prod"} {
+		if !saved.HasProfile(profile) {
+			t.Errorf("profile %s was removed", profile)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package aws
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+const regionHelp = "https://docs.aws.amazon.com/general/latest/gr/rande.html#regional-endpoints"
+
+// Partition describes an AWS partition, a group of regions that share a DNS
+// suffix and the partition of their ARNs, e.g. "aws" or "aws-cn".
+type Partition struct {
+	ID        string
+	DNSSuffix string
+
+	sdk endpoints.Partition
+}
+
+// Region describes a single AWS region.
+type Region struct {
+	ID          string
+	Description string
+	Partition   *Partition
+}
+
+// partitions holds every partition of the vendored AWS SDK's endpoint
+// metadata.
+var partitions = loadPartitions()
+
+// regionSyntax matches anything that looks like a region identifier.
+var regionSyntax = regexp.MustCompile(`^[a-z]{2}(\-[a-z]+)+\-\d+$`)
+
+func loadPartitions() []*Partition {
+	var ps []*Partition
+	for _, p := range endpoints.DefaultPartitions() {
+		ps = append(ps, &Partition{ID: p.ID(), DNSSuffix: p.DNSSuffix(), sdk: p})
+	}
+	return ps
+}
+
+// Partitions returns every known AWS partition.
+func Partitions() []*Partition {
+	return partitions
+}
+
+// Regions returns every known AWS region, sorted by identifier.
+func Regions() []Region {
+	var regions []Region
+	for _, p := range partitions {
+		for id, r := range p.sdk.Regions() {
+			regions = append(regions, Region{ID: id, Description: r.Description(), Partition: p})
+		}
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].ID < regions[j].ID })
+	return regions
+}
+
+// PartitionForRegion returns the partition the region belongs to, either
+// because it is a known region of the partition or because it matches the
+// partition's region naming scheme.
+func PartitionForRegion(region string) (*Partition, bool) {
+	sdk, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if !ok {
+		return nil, false
+	}
+	for _, p := range partitions {
+		if p.ID == sdk.ID() {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// UnknownRegionError is returned when a region is not known to awsctl. It
+// carries the closest known region, if there is one, as a suggestion.
+type UnknownRegionError struct {
+	Region     string
+	Suggestion string
+}
+
+// Error implements the error interface.
+func (e *UnknownRegionError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("region %q is not supported in AWS, did you mean %q? See: %s", e.Region, e.Suggestion, regionHelp)
+	}
+	return fmt.Sprintf("region %q is not supported in AWS. See: %s", e.Region, regionHelp)
+}
+
+// LookupRegion will examine whether or not the region is supported within AWS,
+// based on the partition metadata of the AWS SDK. When allowUnknown is set, a
+// region that is not known yet but looks like a region identifier is accepted
+// too, which allows using regions newer than the vendored AWS SDK; its
+// Partition is then based on the partitions' region naming schemes and may be
+// nil, in which case STS requests need a custom endpoint.
+func LookupRegion(region string, allowUnknown bool) (Region, error) {
+
+	for _, p := range partitions {
+		if r, ok := p.sdk.Regions()[region]; ok {
+			return Region{ID: region, Description: r.Description(), Partition: p}, nil
+		}
+	}
+
+	if allowUnknown && regionSyntax.MatchString(region) {
+		p, _ := PartitionForRegion(region)
+		return Region{ID: region, Partition: p}, nil
+	}
+
+	return Region{}, &UnknownRegionError{Region: region, Suggestion: suggestRegion(region)}
+}
+
+// suggestRegion returns the known region closest to region, or an empty string
+// if none is close enough to be a likely typo.
+func suggestRegion(region string) string {
+	const maxDistance = 3
+
+	suggestion, best := "", maxDistance+1
+	for _, r := range Regions() {
+		if d := levenshtein(region, r.ID); d < best {
+			suggestion, best = r.ID, d
+		}
+	}
+	return suggestion
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j] + 1
+			if d := current[j-1] + 1; d < current[j] {
+				current[j] = d
+			}
+			if d := previous[j-1] + cost; d < current[j] {
+				current[j] = d
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
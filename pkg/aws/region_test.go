@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"testing"
+)
+
+func TestLookupRegion(t *testing.T) {
+	tests := []struct {
+		region       string
+		allowUnknown bool
+		partition    string
+		suggestion   string
+		err          bool
+	}{
+		{"us-east-1", false, "aws", "", false},
+		{"af-south-1", false, "aws", "", false},
+		{"cn-north-1", false, "aws-cn", "", false},
+		{"us-gov-west-1", false, "aws-us-gov", "", false},
+		{"us-east-one", false, "", "us-east-1", true},
+		{"eu-wset-1", false, "", "eu-west-1", true},
+		{"mars-north-1", false, "", "", true},
+		// Regions newer than the SDK are only accepted on request.
+		{"eu-future-9", false, "", "", true},
+		{"eu-future-9", true, "aws", "", false},
+		{"cn-future-9", true, "aws-cn", "", false},
+		{"not a region", true, "", "", true},
+	}
+
+	for _, test := range tests {
+		r, err := LookupRegion(test.region, test.allowUnknown)
+		if (err != nil) != test.err {
+			t.Errorf("LookupRegion(%q, %v) error = %v, want error %v", test.region, test.allowUnknown, err, test.err)
+			continue
+		}
+		if err != nil {
+			unknown, ok := err.(*UnknownRegionError)
+			if !ok || unknown.Suggestion != test.suggestion {
+				t.Errorf("LookupRegion(%q) error = %#v, want suggestion %q", test.region, err, test.suggestion)
+			}
+			continue
+		}
+		if r.ID != test.region || r.Partition == nil || r.Partition.ID != test.partition {
+			t.Errorf("LookupRegion(%q) = %+v, want partition %s", test.region, r, test.partition)
+		}
+	}
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	tests := map[string]string{
+		"eu-central-1":   "aws",
+		"cn-northwest-1": "aws-cn",
+		"us-gov-east-1":  "aws-us-gov",
+		"us-iso-east-1":  "aws-iso",
+	}
+
+	for region, want := range tests {
+		p, ok := PartitionForRegion(region)
+		if !ok || p.ID != want {
+			t.Errorf("PartitionForRegion(%q) = %+v, %v, want %s", region, p, ok, want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"us-east-1", "us-east-1", 0},
+		{"us-east-1", "us-east-2", 1},
+		{"eu-wset-1", "eu-west-1", 2},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
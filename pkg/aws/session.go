@@ -0,0 +1,413 @@
+package aws
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSessionTemplate is the naming template of session profiles when
+	// none is configured.
+	DefaultSessionTemplate = "{{.Name}}_mfa"
+
+	// keySessionTemplate overrides the session naming template of a single
+	// base profile.
+	keySessionTemplate = "awsctl_session_profile_template"
+
+	// keySessionOf records the base profile of a session profile.
+	keySessionOf = "awsctl_session_of"
+
+	// legacySessionSuffix is the suffix used for session profiles before the
+	// naming template was configurable.
+	legacySessionSuffix = "_mfa"
+
+	// keyInheritExclude lists additional keys of a base profile, separated by
+	// commas, that should not be copied into its session profile.
+	keyInheritExclude = "awsctl_inherit_exclude"
+
+	// prefixAwsctl marks keys that only awsctl itself understands.
+	prefixAwsctl = "awsctl_"
+)
+
+// sessionExcludedKeys are the keys of a base profile that describe how to get
+// credentials rather than how to use them, so they never belong in a session
+// profile.
+var sessionExcludedKeys = map[string]bool{
+	keyAccessKeyID:              true,
+	keySecretAccessKey:          true,
+	keySessionToken:             true,
+	keyMFASerial:                true,
+	keyRoleARN:                  true,
+	keySourceProfile:            true,
+	keyExternalID:               true,
+	keyDurationSeconds:          true,
+	keyCredentialProcess:        true,
+	keySSOSession:               true,
+	keySSOStartURL:              true,
+	keySSORegion:                true,
+	keySSOAccountID:             true,
+	keySSORoleName:              true,
+	keyAuthenticationExpiration: true,
+	"credential_source":         true,
+	"web_identity_token_file":   true,
+	"role_session_name":         true,
+}
+
+// inheritable reports whether key should be copied from a base profile into its
+// session profile.
+func inheritable(key string, exclude map[string]bool) bool {
+	return !sessionExcludedKeys[key] && !exclude[key] && !strings.HasPrefix(key, prefixAwsctl)
+}
+
+// SyncSessionConfig mirrors every non-credential key of the base profile's
+// config section, such as "output", "cli_pager", "ca_bundle", "s3" or endpoint
+// overrides, into the session profile's config section. Keys listed within the
+// base profile's "awsctl_inherit_exclude" setting are skipped. Keys of the
+// session profile that are no longer inherited are removed, so the session
+// profile stays in sync with its base profile.
+func (s *Store) SyncSessionConfig(base, session string) error {
+
+	baseSection := s.Config.Section(ConfigSection(base))
+	if baseSection == nil {
+		return ProfileNotFoundError(base)
+	}
+
+	exclude := map[string]bool{}
+	for _, key := range strings.Split(baseSection.Value(keyInheritExclude), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			exclude[key] = true
+		}
+	}
+
+	sessionSection := s.Config.EnsureSection(ConfigSection(session))
+	for _, key := range sessionSection.KeyStrings() {
+		// Leave awsctl's own bookkeeping of the session profile alone.
+		if strings.HasPrefix(key, prefixAwsctl) {
+			continue
+		}
+		if !inheritable(key, exclude) || !baseSection.HasKey(key) {
+			sessionSection.DeleteKey(key)
+		}
+	}
+
+	for _, key := range baseSection.Keys() {
+		if inheritable(key.Name, exclude) {
+			sessionSection.SetKey(key)
+		}
+	}
+
+	return nil
+}
+
+// SaveSession will persist the temporary credentials of a session for the base
+// profile into the session profile, mirror the base profile's settings with
+// SyncSessionConfig, and save both files.
+func (s *Store) SaveSession(base, session string, credentials Profile) error {
+
+	if err := s.SyncSessionConfig(base, session); err != nil {
+		return err
+	}
+	s.Config.Section(ConfigSection(session)).SetValue(keySessionOf, base)
+
+	section := s.Credentials.EnsureSection(CredentialsSection(session))
+	section.SetValue(keyAccessKeyID, credentials.AccessKeyID)
+	section.SetValue(keySecretAccessKey, credentials.SecretAccessKey)
+	section.SetValue(keySessionToken, credentials.SessionToken)
+	section.SetValue(keyMFASerial, credentials.MFASerial)
+	section.SetValue(keyAuthenticationExpiration, credentials.AuthenticationExpiration)
+	section.SetValue(keySessionOf, base)
+
+	return s.Save()
+}
+
+// InvalidateSessions removes the temporary credentials of every session
+// profile of the base profile, e.g. after its MFA device or keys changed. The
+// session profiles' config sections are kept. Nothing is saved; the names of
+// the invalidated session profiles are returned.
+func (s *Store) InvalidateSessions(base string) []string {
+	var invalidated []string
+	for _, session := range s.SessionsOf(base) {
+		if s.Credentials.DeleteSection(CredentialsSection(session)) {
+			invalidated = append(invalidated, session)
+		}
+	}
+	return invalidated
+}
+
+// markSession records the base profile within the existing sections of the
+// session profile.
+func markSession(store *Store, session, base string) {
+	if section := store.Config.Section(ConfigSection(session)); section != nil {
+		section.SetValue(keySessionOf, base)
+	}
+	if section := store.Credentials.Section(CredentialsSection(session)); section != nil {
+		section.SetValue(keySessionOf, base)
+	}
+}
+
+// SessionName renders the session naming template for the base profile, e.g.
+// "{{.Name}}-mfa" renders "cowboy-mfa" for the profile "cowboy".
+func SessionName(tmpl, base string) (string, error) {
+
+	t, err := template.New("session").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid session profile template: %s", tmpl)
+	}
+
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, struct{ Name string }{Name: base}); err != nil {
+		return "", errors.Wrapf(err, "invalid session profile template: %s", tmpl)
+	}
+
+	name := buf.String()
+	switch {
+	case name == "" || name == base:
+		return "", errors.Errorf("session profile template %q must produce a name other than %q", tmpl, base)
+	case strings.ContainsAny(name, "[] \t\r\n"):
+		return "", errors.Errorf("session profile template %q produced an invalid name: %q", tmpl, name)
+	}
+
+	return name, nil
+}
+
+// SessionTemplates holds the session naming templates that apply besides the
+// setting of a base profile. Override, e.g. a flag, takes precedence over the
+// setting of the base profile and Global does not.
+type SessionTemplates struct {
+	Override string
+	Global   string
+}
+
+// SessionTemplate returns the session naming template of the base profile:
+// the override template, or else its own "awsctl_session_profile_template"
+// setting, or else the global template, or else DefaultSessionTemplate.
+func (s *Store) SessionTemplate(base string, templates SessionTemplates) string {
+	if templates.Override != "" {
+		return templates.Override
+	}
+	if tmpl := s.Config.Section(ConfigSection(base)).Value(keySessionTemplate); tmpl != "" {
+		return strings.Trim(tmpl, `"'`)
+	}
+	if templates.Global != "" {
+		return templates.Global
+	}
+	return DefaultSessionTemplate
+}
+
+// SessionProfile returns the name of the session profile of the base profile.
+func (s *Store) SessionProfile(base string, templates SessionTemplates) (string, error) {
+	return SessionName(s.SessionTemplate(base, templates), base)
+}
+
+// Sessions returns every session profile created by awsctl, mapped to the base
+// profile it belongs to. Session profiles created before they were tagged with
+// their base profile are recognized by the legacy "_mfa" suffix.
+func (s *Store) Sessions() map[string]string {
+
+	sessions := map[string]string{}
+	for _, section := range s.Config.Sections() {
+		kind, name := ParseConfigSection(section.Name())
+		if base := section.Value(keySessionOf); kind == SectionProfile && base != "" {
+			sessions[name] = base
+		}
+	}
+	for _, section := range s.Credentials.Sections() {
+		name := section.Name()
+		if base := section.Value(keySessionOf); base != "" {
+			sessions[name] = base
+			continue
+		}
+		if _, ok := sessions[name]; ok {
+			continue
+		}
+		base := strings.TrimSuffix(name, legacySessionSuffix)
+		if base != name && section.HasKey(keySessionToken) && s.Config.HasSection(ConfigSection(base)) {
+			sessions[name] = base
+		}
+	}
+
+	return sessions
+}
+
+// SessionsOf returns the names of every session profile of the base profile in
+// order.
+func (s *Store) SessionsOf(base string) []string {
+	var names []string
+	for session, b := range s.Sessions() {
+		if b == base {
+			names = append(names, session)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SessionRename describes a session profile that was renamed to match its
+// naming template. To is empty when the session profile was removed instead,
+// because another session profile of the same base profile was fresher.
+type SessionRename struct {
+	Base string
+	From string
+	To   string
+}
+
+// freshestSession returns the session profile whose credentials expire last,
+// and the others. Session profiles without a known expiration are the oldest;
+// of equally fresh ones preferred, or else the first by name, is returned.
+func (s *Store) freshestSession(sessions []string, preferred string) (string, []string) {
+
+	var (
+		freshest   string
+		expiration time.Time
+		others     []string
+	)
+	for _, session := range sessions {
+		p, _ := s.Profile(session)
+		e, _ := p.SessionExpiration()
+		switch {
+		case freshest == "":
+		case e.After(expiration), e.Equal(expiration) && session == preferred:
+			others = append(others, freshest)
+		default:
+			others = append(others, session)
+			continue
+		}
+		freshest, expiration = session, e
+	}
+	sort.Strings(others)
+	return freshest, others
+}
+
+// MigrateSession renames the session profile of the base profile in both
+// files when it no longer matches the naming template. When the base profile
+// has several session profiles, e.g. of an older template, only the freshest
+// is kept and the others are removed. Nothing is saved.
+func (s *Store) MigrateSession(base string, templates SessionTemplates) ([]SessionRename, error) {
+
+	expected, err := s.SessionProfile(base, templates)
+	if err != nil {
+		return nil, err
+	}
+
+	var renames []SessionRename
+	freshest, stale := s.freshestSession(s.SessionsOf(base), expected)
+	for _, session := range stale {
+		removeSections(session, s)
+		renames = append(renames, SessionRename{Base: base, From: session})
+	}
+	if freshest != "" && freshest != expected {
+		if err = renameSections(s, freshest, expected); err != nil {
+			return nil, err
+		}
+		markSession(s, expected, base)
+		renames = append(renames, SessionRename{Base: base, From: freshest, To: expected})
+	}
+
+	return renames, nil
+}
+
+// MigrateSessions calls MigrateSession for every base profile that has a
+// session profile. Nothing is saved.
+func (s *Store) MigrateSessions(templates SessionTemplates) ([]SessionRename, error) {
+
+	bases := map[string]bool{}
+	for _, base := range s.Sessions() {
+		bases[base] = true
+	}
+
+	var names []string
+	for base := range bases {
+		names = append(names, base)
+	}
+	sort.Strings(names)
+
+	var renames []SessionRename
+	for _, base := range names {
+		r, err := s.MigrateSession(base, templates)
+		if err != nil {
+			return nil, err
+		}
+		renames = append(renames, r...)
+	}
+
+	return renames, nil
+}
+
+// SessionExpiration returns when the session credentials of the profile
+// expire. It reports false if the expiration is unknown.
+func (p Profile) SessionExpiration() (time.Time, bool) {
+	if p.AuthenticationExpiration == "" {
+		return time.Time{}, false
+	}
+	expiration, err := time.Parse(time.RFC3339, p.AuthenticationExpiration)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiration, true
+}
+
+// Logout wipes the session credentials of the specific profiles. Session
+// profiles created by awsctl, either named directly or belonging to one of the
+// base profiles, are removed from both files; any other profile holding a
+// session token has its session keys removed. When expiredOnly is set only
+// sessions known to have expired at now are wiped. Nothing is saved; the names
+// of the wiped profiles are returned.
+func (s *Store) Logout(profiles []string, expiredOnly bool, now time.Time) ([]string, error) {
+
+	sessions := s.Sessions()
+
+	var targets []string
+	for _, profile := range profiles {
+		if _, ok := sessions[profile]; ok {
+			targets = append(targets, profile)
+			continue
+		}
+		targets = append(targets, s.SessionsOf(profile)...)
+		targets = append(targets, profile)
+	}
+
+	var wiped []string
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		p, err := s.Profile(target)
+		if err != nil {
+			return nil, err
+		}
+		_, isSession := sessions[target]
+		if !isSession && p.SessionToken == "" {
+			continue
+		}
+		if expiredOnly {
+			expiration, ok := p.SessionExpiration()
+			if !ok || now.Before(expiration) {
+				continue
+			}
+		}
+
+		if isSession {
+			removeSections(target, s)
+		} else {
+			for _, section := range []*Section{s.Config.Section(ConfigSection(target)), s.Credentials.Section(CredentialsSection(target))} {
+				if section == nil {
+					continue
+				}
+				for _, key := range []string{keyAccessKeyID, keySecretAccessKey, keySessionToken, keyAuthenticationExpiration} {
+					section.DeleteKey(key)
+				}
+			}
+		}
+		wiped = append(wiped, target)
+	}
+
+	return wiped, nil
+}
@@ -0,0 +1,367 @@
+package aws
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSyncSessionConfig(t *testing.T) {
+	store := newTestStore(`[profile cowboy]
+region = eu-west-1
+output = json
+cli_pager =
+ca_bundle = /etc/ssl/corp.pem
+mfa_serial = arn:aws:iam::123456789012:mfa/cowboy
+role_session_name = cowboy
+awsctl_session_duration = 1h
+awsctl_inherit_exclude = ca_bundle, output
+s3 =
+  max_concurrent_requests = 20
+
+[profile cowboy_mfa]
+region = us-east-1
+retry_mode = adaptive
+output = text
+awsctl_session_of = cowboy
+`, "")
+
+	if err := store.SyncSessionConfig("cowboy", "cowboy_mfa"); err != nil {
+		t.Fatal(err)
+	}
+
+	session := store.Config.Section("profile cowboy_mfa")
+	tests := []struct {
+		key   string
+		value string
+		has   bool
+	}{
+		{"region", "eu-west-1", true},
+		{"cli_pager", "", true},
+		{"s3", "", true},
+		// Excluded with awsctl_inherit_exclude.
+		{"ca_bundle", "", false},
+		{"output", "", false},
+		// Keys that describe how to get credentials.
+		{"mfa_serial", "", false},
+		{"role_session_name", "", false},
+		// awsctl's own settings of the base profile.
+		{"awsctl_session_duration", "", false},
+		{"awsctl_inherit_exclude", "", false},
+		// No longer set on the base profile.
+		{"retry_mode", "", false},
+		// awsctl's own bookkeeping of the session profile.
+		{"awsctl_session_of", "cowboy", true},
+	}
+	for _, test := range tests {
+		if has := session.HasKey(test.key); has != test.has {
+			t.Errorf("session has %s = %v, want %v", test.key, has, test.has)
+		}
+		if got := session.Value(test.key); got != test.value {
+			t.Errorf("session %s = %q, want %q", test.key, got, test.value)
+		}
+	}
+	if s3 := session.Key("s3"); s3 == nil || len(s3.Nested) != 1 || s3.Nested[0].Value != "20" {
+		t.Errorf("nested keys of s3 were not inherited: %+v", s3)
+	}
+}
+
+func TestSyncSessionConfigNewSession(t *testing.T) {
+	store := newTestStore("[profile cowboy]\nregion = eu-west-1\n", "")
+
+	if err := store.SyncSessionConfig("cowboy", "cowboy_mfa"); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Config.Section("profile cowboy_mfa").Value("region"); got != "eu-west-1" {
+		t.Errorf("region of the new session = %q", got)
+	}
+}
+
+func TestSyncSessionConfigMissingBase(t *testing.T) {
+	store := newTestStore("", "")
+
+	err := store.SyncSessionConfig("cowboy", "cowboy_mfa")
+	if KindOf(err) != ErrorProfileNotFound {
+		t.Errorf("got error %v, want %s", err, ErrorProfileNotFound)
+	}
+}
+
+func TestSessionName(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+		err  bool
+	}{
+		{DefaultSessionTemplate, "cowboy_mfa", false},
+		{"{{.Name}}-session", "cowboy-session", false},
+		{"mfa-{{.Name}}", "mfa-cowboy", false},
+		{"{{.Name}}", "", true},
+		{"", "", true},
+		{"{{.Name}} mfa", "", true},
+		{"[{{.Name}}]", "", true},
+		{"{{.Missing}}", "", true},
+		{"{{.Name", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := SessionName(test.tmpl, "cowboy")
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("SessionName(%q) = %q, %v, want %q, error %v", test.tmpl, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestSessionTemplate(t *testing.T) {
+	store := newTestStore(`[profile own]
+awsctl_session_profile_template = "{{.Name}}-own"
+[profile plain]
+`, "")
+
+	tests := []struct {
+		base      string
+		templates SessionTemplates
+		want      string
+	}{
+		{"own", SessionTemplates{Override: "{{.Name}}-flag", Global: "{{.Name}}-global"}, "{{.Name}}-flag"},
+		{"own", SessionTemplates{Global: "{{.Name}}-global"}, "{{.Name}}-own"},
+		{"plain", SessionTemplates{Global: "{{.Name}}-global"}, "{{.Name}}-global"},
+		{"plain", SessionTemplates{}, DefaultSessionTemplate},
+	}
+
+	for _, test := range tests {
+		if got := store.SessionTemplate(test.base, test.templates); got != test.want {
+			t.Errorf("SessionTemplate(%q, %+v) = %q, want %q", test.base, test.templates, got, test.want)
+		}
+	}
+}
+
+// sessionsTestStore has two session profiles of cowboy, of an older and the
+// current template, which expire at older and newer.
+func sessionsTestStore(older, newer string) *Store {
+	return newTestStore(`[profile cowboy]
+region = eu-west-1
+mfa_serial = arn:aws:iam::123456789012:mfa/cowboy
+
+[profile cowboy_mfa]
+region = eu-west-1
+awsctl_session_of = cowboy
+
+[profile cowboy-session]
+region = eu-west-1
+awsctl_session_of = cowboy
+`, `[cowboy]
+aws_access_key_id = AKIA
+aws_secret_access_key = secret
+
+[cowboy_mfa]
+aws_access_key_id = ASIALEGACY
+aws_session_token = legacy
+authentication_expiration = `+older+`
+awsctl_session_of = cowboy
+
+[cowboy-session]
+aws_access_key_id = ASIACURRENT
+aws_session_token = current
+authentication_expiration = `+newer+`
+awsctl_session_of = cowboy
+`)
+}
+
+func TestMigrateSessionKeepsFreshest(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		older    string
+		newer    string
+		renames  []SessionRename
+		want     string
+	}{
+		{
+			name:     "fresher session already has the expected name",
+			template: "{{.Name}}-session",
+			older:    "2020-01-01T00:00:00Z",
+			newer:    "2020-01-02T00:00:00Z",
+			renames:  []SessionRename{{Base: "cowboy", From: "cowboy_mfa"}},
+			want:     "ASIACURRENT",
+		},
+		{
+			name:     "fresher session is renamed over the stale one",
+			template: DefaultSessionTemplate,
+			older:    "2020-01-01T00:00:00Z",
+			newer:    "2020-01-02T00:00:00Z",
+			renames: []SessionRename{
+				{Base: "cowboy", From: "cowboy_mfa"},
+				{Base: "cowboy", From: "cowboy-session", To: "cowboy_mfa"},
+			},
+			want: "ASIACURRENT",
+		},
+		{
+			name:     "equally fresh sessions keep the expected name",
+			template: DefaultSessionTemplate,
+			older:    "2020-01-02T00:00:00Z",
+			newer:    "2020-01-02T00:00:00Z",
+			renames:  []SessionRename{{Base: "cowboy", From: "cowboy-session"}},
+			want:     "ASIALEGACY",
+		},
+		{
+			name:     "sessions are merged into a new template",
+			template: "mfa-{{.Name}}",
+			older:    "",
+			newer:    "2020-01-02T00:00:00Z",
+			renames: []SessionRename{
+				{Base: "cowboy", From: "cowboy_mfa"},
+				{Base: "cowboy", From: "cowboy-session", To: "mfa-cowboy"},
+			},
+			want: "ASIACURRENT",
+		},
+	}
+
+	for _, test := range tests {
+		store := sessionsTestStore(test.older, test.newer)
+		renames, err := store.MigrateSession("cowboy", SessionTemplates{Override: test.template})
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(renames, test.renames) {
+			t.Errorf("%s: renames = %+v, want %+v", test.name, renames, test.renames)
+		}
+
+		expected, _ := SessionName(test.template, "cowboy")
+		if sessions := store.SessionsOf("cowboy"); !reflect.DeepEqual(sessions, []string{expected}) {
+			t.Errorf("%s: sessions = %v, want only %s", test.name, sessions, expected)
+		}
+		if p, _ := store.Profile(expected); p.AccessKeyID != test.want || p.Region != "eu-west-1" {
+			t.Errorf("%s: kept session %+v, want %s", test.name, p, test.want)
+		}
+
+		// Migrating again changes nothing.
+		if renames, err = store.MigrateSession("cowboy", SessionTemplates{Override: test.template}); err != nil || len(renames) > 0 {
+			t.Errorf("%s: second migration = %+v, %v", test.name, renames, err)
+		}
+	}
+}
+
+func TestRenameProfileKeepsFreshestSession(t *testing.T) {
+	store, cleanup := openTestStore(t, "", "")
+	defer cleanup()
+	fixture := sessionsTestStore("2020-01-01T00:00:00Z", "2020-01-02T00:00:00Z")
+	store.Config, store.Credentials = fixture.Config, fixture.Credentials
+
+	_, removed, err := RenameProfile("cowboy", "rider", SessionTemplates{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{"cowboy_mfa"}) {
+		t.Errorf("removed = %v, want [cowboy_mfa]", removed)
+	}
+	if sessions := store.SessionsOf("rider"); !reflect.DeepEqual(sessions, []string{"rider_mfa"}) {
+		t.Errorf("sessions = %v, want only rider_mfa", sessions)
+	}
+	if p, _ := store.Profile("rider_mfa"); p.AccessKeyID != "ASIACURRENT" {
+		t.Errorf("kept session %+v, want the fresher one", p)
+	}
+	if store.HasProfile("cowboy") || len(store.SessionsOf("cowboy")) > 0 {
+		t.Error("cowboy or its sessions are left behind")
+	}
+}
+
+func TestCloneProfileCopiesFreshestSession(t *testing.T) {
+	store, cleanup := openTestStore(t, "", "")
+	defer cleanup()
+	fixture := sessionsTestStore("2020-01-02T00:00:00Z", "2020-01-01T00:00:00Z")
+	store.Config, store.Credentials = fixture.Config, fixture.Credentials
+
+	if err := CloneProfile("cowboy", "rider", SessionTemplates{}, store); err != nil {
+		t.Fatal(err)
+	}
+	if sessions := store.SessionsOf("rider"); !reflect.DeepEqual(sessions, []string{"rider_mfa"}) {
+		t.Errorf("sessions = %v, want only rider_mfa", sessions)
+	}
+	if p, _ := store.Profile("rider_mfa"); p.AccessKeyID != "ASIALEGACY" {
+		t.Errorf("copied session %+v, want the fresher one", p)
+	}
+	if sessions := store.SessionsOf("cowboy"); len(sessions) != 2 {
+		t.Errorf("sessions of the source = %v, want both", sessions)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	const (
+		config = `[profile cowboy]
+[profile cowboy_mfa]
+awsctl_session_of = cowboy
+[profile old_mfa]
+awsctl_session_of = cowboy
+[profile exported]
+[profile keys]
+`
+		credentials = `[cowboy]
+aws_access_key_id = AKIA
+aws_secret_access_key = secret
+[cowboy_mfa]
+aws_session_token = current
+authentication_expiration = 2020-01-02T00:00:00Z
+awsctl_session_of = cowboy
+[old_mfa]
+aws_session_token = old
+authentication_expiration = 2020-01-01T00:00:00Z
+awsctl_session_of = cowboy
+[exported]
+aws_access_key_id = ASIA
+aws_secret_access_key = secret
+aws_session_token = token
+region = eu-west-1
+[keys]
+aws_access_key_id = AKIA
+aws_secret_access_key = secret
+`
+	)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		profiles    []string
+		expiredOnly bool
+		want        []string
+	}{
+		{"base profile", []string{"cowboy"}, false, []string{"cowboy_mfa", "old_mfa"}},
+		{"session profile", []string{"old_mfa"}, false, []string{"old_mfa"}},
+		{"expired only", []string{"cowboy"}, true, []string{"old_mfa"}},
+		{"unknown expiration", []string{"exported"}, true, nil},
+		{"foreign session", []string{"exported"}, false, []string{"exported"}},
+		{"long-term keys", []string{"keys"}, false, nil},
+	}
+
+	for _, test := range tests {
+		store := newTestStore(config, credentials)
+		wiped, err := store.Logout(test.profiles, test.expiredOnly, now)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(wiped, test.want) {
+			t.Errorf("%s: wiped %v, want %v", test.name, wiped, test.want)
+		}
+		for _, profile := range test.want {
+			if profile == "exported" {
+				continue
+			}
+			if store.HasProfile(profile) {
+				t.Errorf("%s: session profile %s was not removed", test.name, profile)
+			}
+		}
+		if p, _ := store.Profile("cowboy"); p.AccessKeyID != "AKIA" {
+			t.Errorf("%s: keys of the base profile were wiped", test.name)
+		}
+	}
+
+	store := newTestStore(config, credentials)
+	if _, err := store.Logout([]string{"exported"}, false, now); err != nil {
+		t.Fatal(err)
+	}
+	section := store.Credentials.Section("exported")
+	if section == nil || section.HasKey("aws_session_token") || section.HasKey("aws_access_key_id") || section.Value("region") != "eu-west-1" {
+		t.Errorf("session keys of exported were not wiped, or other keys were: %+v", section)
+	}
+}
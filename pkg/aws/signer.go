@@ -0,0 +1,65 @@
+package aws
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/pkg/errors"
+)
+
+// PresignLimits are the limits of the expiration of presigned requests.
+var PresignLimits = DurationLimits{
+	API:    "Signature Version 4",
+	Min:    time.Second,
+	Max:    7 * 24 * time.Hour,
+	Reason: "the maximum expiration of presigned requests",
+}
+
+// signer returns a Signature Version 4 signer for the credentials. With
+// unsignedPayload the body is not part of the signature, which only some
+// services accept.
+func signer(creds Profile, unsignedPayload bool) *v4.Signer {
+	return v4.NewSigner(
+		credentials.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken),
+		func(s *v4.Signer) {
+			s.UnsignedPayload = unsignedPayload
+		},
+	)
+}
+
+// bodyReader returns a reader for the signer, which expects no reader for an
+// empty body.
+func bodyReader(body []byte) io.ReadSeeker {
+	if len(body) == 0 {
+		return nil
+	}
+	return bytes.NewReader(body)
+}
+
+// SignRequest signs the request for the service in the region with the
+// credentials, and attaches the body to it.
+func SignRequest(r *http.Request, body []byte, creds Profile, service, region string, unsignedPayload bool) error {
+	if _, err := signer(creds, unsignedPayload).Sign(r, bodyReader(body), service, region, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to sign request")
+	}
+	r.ContentLength = int64(len(body))
+	return nil
+}
+
+// PresignRequest adds a signature that expires after expires to the URL of
+// the request. It returns the headers that were signed, which have to be sent
+// along with the URL.
+func PresignRequest(r *http.Request, body []byte, creds Profile, service, region string, expires time.Duration, unsignedPayload bool) (http.Header, error) {
+	if err := PresignLimits.Validate(expires); err != nil {
+		return nil, err
+	}
+	header, err := signer(creds, unsignedPayload).Presign(r, bodyReader(body), service, region, expires, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to presign request")
+	}
+	return header, nil
+}
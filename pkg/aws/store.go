@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+)
+
+// Store represents the pair of AWS config and credentials files that hold
+// every profile. Changes are made through the Config and Credentials Files and
+// persisted with Save.
+type Store struct {
+	Config      *File
+	Credentials *File
+
+	configFile      string
+	credentialsFile string
+	lock            *FileLock
+}
+
+// OpenStore will read and parse the specific config and credentials files.
+// Missing files are treated as empty files.
+func OpenStore(configFile, credentialsFile string) (*Store, error) {
+
+	config, err := LoadFile(configFile)
+	if err != nil {
+		return nil, fileError(err, "failed to read config file")
+	}
+
+	credentials, err := LoadFile(credentialsFile)
+	if err != nil {
+		return nil, fileError(err, "failed to read credentials file")
+	}
+
+	return &Store{
+		Config:          config,
+		Credentials:     credentials,
+		configFile:      configFile,
+		credentialsFile: credentialsFile,
+	}, nil
+}
+
+// LockStore takes the lock of the AWS files, see LockFile, and then reads
+// them, so changes made by other awsctl processes are neither missed nor
+// overwritten. The lock is held until Unlock is called.
+func LockStore(configFile, credentialsFile string, timeout time.Duration) (*Store, error) {
+
+	lock, err := LockFile(credentialsFile+".lock", timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := OpenStore(configFile, credentialsFile)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+
+	store.lock = lock
+	return store, nil
+}
+
+// Unlock releases the lock taken by LockStore. It does nothing for stores
+// that are not locked.
+func (s *Store) Unlock() error {
+	if s.lock == nil {
+		return nil
+	}
+	err := s.lock.Unlock()
+	s.lock = nil
+	return err
+}
+
+// Save will persist both the config and credentials files. Each file is
+// replaced atomically, and the config file is restored if the credentials file
+// cannot be saved, so a profile is never left half changed.
+func (s *Store) Save() error {
+
+	previous, err := LoadFile(s.configFile)
+	if err != nil {
+		return fileError(err, "failed to read config file")
+	}
+
+	if err = s.Config.SaveTo(s.configFile); err != nil {
+		return fileError(err, "failed to save new config file")
+	}
+
+	if err = s.Credentials.SaveTo(s.credentialsFile); err != nil {
+		if rerr := previous.SaveTo(s.configFile); rerr != nil {
+			return fileError(err, fmt.Sprintf("failed to save new credentials file (restoring config file failed: %s)", rerr))
+		}
+		return fileError(err, "failed to save new credentials file")
+	}
+
+	return nil
+}
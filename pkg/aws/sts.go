@@ -0,0 +1,142 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+const (
+	// STSRegionalEndpoints sends STS requests to the endpoint of the profile's
+	// region. This is the default.
+	STSRegionalEndpoints = "regional"
+	// STSLegacyEndpoints sends STS requests of the AWS Standard partition to
+	// the global endpoint.
+	STSLegacyEndpoints = "legacy"
+
+	keySTSRegionalEndpoints = "sts_regional_endpoints"
+	keySTSEndpointURL       = "sts_endpoint_url"
+
+	// stsGlobalRegion is the region requests to the global STS endpoint are
+	// signed for.
+	stsGlobalRegion = "us-east-1"
+)
+
+// STSConfig describes how to reach the AWS Security Token Service.
+type STSConfig struct {
+	// Region is the region of the profile.
+	Region string
+	// RegionalEndpoints is either STSRegionalEndpoints or STSLegacyEndpoints.
+	// An empty value means STSRegionalEndpoints.
+	RegionalEndpoints string
+	// EndpointURL overrides the resolved endpoint when it is set.
+	EndpointURL string
+}
+
+// Resolve returns the STS endpoint URL and the region requests to it must be
+// signed for.
+func (c STSConfig) Resolve() (string, string, error) {
+
+	if c.Region == "" {
+		return "", "", errors.New("region must be set to resolve the STS endpoint")
+	}
+
+	if c.EndpointURL != "" {
+		return c.EndpointURL, c.Region, nil
+	}
+
+	partition, ok := PartitionForRegion(c.Region)
+	if !ok {
+		return "", "", &UnknownRegionError{Region: c.Region, Suggestion: suggestRegion(c.Region)}
+	}
+
+	switch c.RegionalEndpoints {
+	case "", STSRegionalEndpoints:
+	case STSLegacyEndpoints:
+		// Only the AWS Standard partition has a global endpoint.
+		if partition.ID == "aws" {
+			return fmt.Sprintf("https://sts.%s", partition.DNSSuffix), stsGlobalRegion, nil
+		}
+	default:
+		return "", "", errors.Errorf("%s must be %q or %q, not %q", keySTSRegionalEndpoints, STSRegionalEndpoints, STSLegacyEndpoints, c.RegionalEndpoints)
+	}
+
+	return fmt.Sprintf("https://sts.%s.%s", c.Region, partition.DNSSuffix), c.Region, nil
+}
+
+// client returns an STS client for the resolved endpoint that signs its
+// requests with creds, never with the default credential chain of the AWS SDK.
+func (c STSConfig) client(creds *credentials.Credentials) (*sts.STS, error) {
+
+	endpoint, signingRegion, err := c.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(signingRegion),
+		Endpoint:    aws.String(endpoint),
+		Credentials: creds,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create AWS session")
+	}
+
+	return sts.New(sess), nil
+}
+
+// CallerARN returns the ARN of the identity the temporary credentials of a
+// session profile belong to.
+func CallerARN(stsConfig STSConfig, session Profile) (string, error) {
+
+	creds := credentials.NewStaticCredentials(session.AccessKeyID, session.SecretAccessKey, session.SessionToken)
+	svc, err := stsConfig.client(creds)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := svc.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", requestError(err, "get caller identity failed")
+	}
+
+	return aws.StringValue(result.Arn), nil
+}
+
+// ARNPartition returns the partition of an ARN such as
+// "arn:aws-cn:iam::123456789012:mfa/cowboy". It reports false for values that
+// are not ARNs, e.g. the serial number of a hardware MFA device.
+func ARNPartition(arn string) (string, bool) {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// validateMFAPartition ensures an MFA device ARN belongs to the same partition
+// as the region the session is requested in, since STS rejects cross-partition
+// requests with a confusing error.
+func validateMFAPartition(serialNumber, region string) error {
+
+	arnPartition, ok := ARNPartition(serialNumber)
+	if !ok {
+		return nil
+	}
+
+	partition, ok := PartitionForRegion(region)
+	if !ok {
+		return nil
+	}
+
+	if arnPartition != partition.ID {
+		return errors.Errorf("MFA device %s belongs to the %s partition, but region %s belongs to the %s partition", serialNumber, arnPartition, region, partition.ID)
+	}
+
+	return nil
+}
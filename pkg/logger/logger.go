@@ -1,13 +1,14 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/fatih/color"
+	colorable "github.com/mattn/go-colorable"
 	"github.com/olekukonko/tablewriter"
 )
 
@@ -28,162 +29,282 @@ const (
 	AskLabel = "?"
 )
 
+// Logger writes leveled, labeled statements. Diagnostics, such as info and
+// warning logs, are written to Err, while data, such as tables and the
+// statements of Log and Always, are written to Out.
+type Logger struct {
+	// Level defines the log level.
+	Level int
+	// Color toggles output colorization.
+	Color bool
+	// Timestamps toggles timestamps on output logs.
+	Timestamps bool
+	// JSON writes every statement as a single line JSON object instead.
+	JSON bool
+
+	// Out receives data.
+	Out io.Writer
+	// Err receives diagnostics.
+	Err io.Writer
+}
+
+// New returns a Logger writing data to out and diagnostics to err, with the
+// default log level and colors enabled.
+func New(out, err io.Writer) *Logger {
+	return &Logger{
+		Level: 3,
+		Color: true,
+		Out:   out,
+		Err:   err,
+	}
+}
+
+// Default is the Logger used by the package level functions. It writes to
+// standard output and standard error.
+var Default = New(colorable.NewColorableStdout(), colorable.NewColorableStderr())
+
 var (
 	// Level defines the default log level.
+	//
+	// Deprecated: Use SetLevel or Default.Level instead. Changes are applied
+	// to Default by the next package level function.
 	Level = 3
 	// Color toggles output colorization.
+	//
+	// Deprecated: Use SetColor or Default.Color instead. Changes are applied
+	// to Default by the next package level function.
 	Color = true
 	// Timestamps toggles timestamps on output logs.
+	//
+	// Deprecated: Use SetTimestamps or Default.Timestamps instead. Changes
+	// are applied to Default by the next package level function.
 	Timestamps = false
 )
 
-// Log will print a formatted generic statement to standard output.
-func Log(format string, a ...interface{}) {
-	a, w := extractLoggerArgs(format, a...)
-	fmt.Fprintf(w, label(format, ""), a...)
-}
+// applied holds the values of Level, Color and Timestamps that were last
+// applied to Default, so only changes to them override Default's settings.
+var applied = struct {
+	level      int
+	color      bool
+	timestamps bool
+}{Level, Color, Timestamps}
 
-// Table will print headers and data in a pretty formatted ASCII table.
-func Table(headers []string, data [][]string) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(headers)
-	for _, v := range data {
-		table.Append(v)
+// std returns Default after applying any changes to Level, Color and
+// Timestamps.
+func std() *Logger {
+	if Level != applied.level {
+		Default.Level, applied.level = Level, Level
 	}
-	table.Render()
-}
-
-// Ask will always print a formatted generic statement to standard output
-// formatted to be a question.
-func Ask(format string, a ...interface{}) {
-	a, w := extractLoggerArgs(format, a...)
-	s := fmt.Sprintf(label(format, AskLabel), a...)
-
-	if Color {
-		w = color.Output
-		s = color.YellowString(s)
+	if Color != applied.color {
+		Default.Color, applied.color = Color, Color
+	}
+	if Timestamps != applied.timestamps {
+		Default.Timestamps, applied.timestamps = Timestamps, Timestamps
 	}
+	return Default
+}
 
-	fmt.Fprintf(w, s)
+// SetLevel sets the log level of Default.
+func SetLevel(level int) {
+	Level, applied.level, Default.Level = level, level, level
 }
 
-// Always will "always" print a formatted generic statement to standard output.
-func Always(format string, a ...interface{}) {
-	a, w := extractLoggerArgs(format, a...)
-	s := fmt.Sprintf(label(format, AlwaysLabel), a...)
+// SetColor toggles the output colorization of Default.
+func SetColor(enabled bool) {
+	Color, applied.color, Default.Color = enabled, enabled, enabled
+}
 
-	if Color {
-		w = color.Output
-		s = color.BlueString(s)
-	}
+// SetTimestamps toggles the timestamps of Default.
+func SetTimestamps(enabled bool) {
+	Timestamps, applied.timestamps, Default.Timestamps = enabled, enabled, enabled
+}
 
-	fmt.Fprintf(w, s)
+// entry is a statement in JSON mode.
+type entry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
 }
 
-// Critical will print a formatted generic statement to standard output if the
-// global level is set to 1 or higher. The print statement will have a color of
-// red if color is enabled.
-func Critical(format string, a ...interface{}) {
-	if Level >= 1 {
-		a, w := extractLoggerArgs(format, a...)
-		s := fmt.Sprintf(label(format, CriticalLabel), a...)
+// Log will print a formatted generic statement.
+func (l *Logger) Log(format string, a ...interface{}) {
+	l.print(l.Out, "log", "", nil, format, a...)
+}
 
-		if Color {
-			w = color.Output
-			s = color.RedString(s)
+// Table will print headers and data in a pretty formatted ASCII table. In JSON
+// mode every row is printed as an object keyed by the headers.
+func (l *Logger) Table(headers []string, data [][]string) {
+	if l.JSON {
+		for _, row := range data {
+			object := map[string]string{}
+			for i, header := range headers {
+				if i < len(row) {
+					object[strings.ToLower(strings.Replace(header, " ", "_", -1))] = row[i]
+				}
+			}
+			l.writeJSON(l.Out, object)
 		}
+		return
+	}
 
-		fmt.Fprintf(w, s)
+	table := tablewriter.NewWriter(l.Out)
+	table.SetHeader(headers)
+	for _, v := range data {
+		table.Append(v)
 	}
+	table.Render()
 }
 
-// Info will print a formatted generic statement to standard output if the
-// global level is set to 3 or higher. The print statement will have a color of
-// cyan if color is enabled.
-func Info(format string, a ...interface{}) {
-	if Level >= 3 {
-		a, w := extractLoggerArgs(format, a...)
-		s := fmt.Sprintf(label(format, InfoLabel), a...)
+// Ask will always print a formatted generic statement formatted to be a
+// question.
+func (l *Logger) Ask(format string, a ...interface{}) {
+	l.print(l.Err, "ask", AskLabel, color.New(color.FgYellow), format, a...)
+}
 
-		if Color {
-			w = color.Output
-			s = color.MagentaString(s)
-		}
+// Always will "always" print a formatted generic statement.
+func (l *Logger) Always(format string, a ...interface{}) {
+	l.print(l.Out, "always", AlwaysLabel, color.New(color.FgBlue), format, a...)
+}
 
-		fmt.Fprintf(w, s)
+// Critical will print a formatted generic statement if the level is set to 1
+// or higher. The print statement will have a color of red if color is enabled.
+func (l *Logger) Critical(format string, a ...interface{}) {
+	if l.Level >= 1 {
+		l.print(l.Err, "critical", CriticalLabel, color.New(color.FgRed), format, a...)
 	}
 }
 
-// Success will print a formatted generic statement to standard output if the
-// global level is set to 3 or higher. The print statement will have a color of
-// cyan if color is enabled.
-func Success(format string, a ...interface{}) {
-	if Level >= 3 {
-		a, w := extractLoggerArgs(format, a...)
-		s := fmt.Sprintf(label(format, SuccessLabel), a...)
-
-		if Color {
-			w = color.Output
-			s = color.GreenString(s)
-		}
-
-		fmt.Fprintf(w, s)
+// Info will print a formatted generic statement if the level is set to 3 or
+// higher. The print statement will have a color of magenta if color is
+// enabled.
+func (l *Logger) Info(format string, a ...interface{}) {
+	if l.Level >= 3 {
+		l.print(l.Err, "info", InfoLabel, color.New(color.FgMagenta), format, a...)
 	}
 }
 
-// Debug will print a formatted generic statement to standard output if the
-// global level is set to 4 or higher.
-func Debug(format string, a ...interface{}) {
-	if Level >= 4 {
-		a, w := extractLoggerArgs(format, a...)
-		s := fmt.Sprintf(label(format, DebugLabel), a...)
-
-		fmt.Fprintf(w, s)
+// Success will print a formatted generic statement if the level is set to 3
+// or higher. The print statement will have a color of green if color is
+// enabled.
+func (l *Logger) Success(format string, a ...interface{}) {
+	if l.Level >= 3 {
+		l.print(l.Err, "success", SuccessLabel, color.New(color.FgGreen), format, a...)
 	}
 }
 
-// Warning will print a formatted generic statement to standard output if the
-// global level is set to 2 or higher. The print statement will have a color of
-// yellow if color is enabled.
-func Warning(format string, a ...interface{}) {
-	if Level >= 2 {
-		a, w := extractLoggerArgs(format, a...)
-		s := fmt.Sprintf(label(format, WarningLabel), a...)
-
-		if Color {
-			w = color.Output
-			s = color.YellowString(s)
-		}
-
-		fmt.Fprintf(w, s)
+// Debug will print a formatted generic statement if the level is set to 4 or
+// higher.
+func (l *Logger) Debug(format string, a ...interface{}) {
+	if l.Level >= 4 {
+		l.print(l.Err, "debug", DebugLabel, nil, format, a...)
 	}
 }
 
-func extractLoggerArgs(format string, a ...interface{}) ([]interface{}, io.Writer) {
-	var w io.Writer = os.Stdout
+// Warning will print a formatted generic statement if the level is set to 2
+// or higher. The print statement will have a color of yellow if color is
+// enabled.
+func (l *Logger) Warning(format string, a ...interface{}) {
+	if l.Level >= 2 {
+		l.print(l.Err, "warning", WarningLabel, color.New(color.FgYellow), format, a...)
+	}
+}
 
+// print formats the statement and writes it to w, unless the last argument is
+// an io.Writer, which is then written to instead.
+func (l *Logger) print(w io.Writer, level, label string, c *color.Color, format string, a ...interface{}) {
 	if n := len(a); n > 0 {
-		// extract an io.Writer at the end of a
 		if value, ok := a[n-1].(io.Writer); ok {
 			w = value
 			a = a[0 : n-1]
 		}
 	}
 
-	return a, w
-}
+	message := fmt.Sprintf(format, a...)
+	now := time.Now()
+
+	if l.JSON {
+		l.writeJSON(w, entry{
+			Time:    now.Format(time.RFC3339),
+			Level:   level,
+			Message: strings.TrimSpace(message),
+		})
+		return
+	}
 
-func label(format, label string) string {
 	if !strings.Contains(format, "\n") {
-		format = fmt.Sprintf("%s%s", format, "\n")
+		message += "\n"
 	}
 	if label != "" {
-		format = fmt.Sprintf("[%s]  %s", label, format)
+		message = fmt.Sprintf("[%s]  %s", label, message)
+	}
+	if l.Timestamps {
+		message = fmt.Sprintf("%s %s", now.Format(time.RFC3339), message)
 	}
-	if Timestamps {
-		t := time.Now()
-		rfct := t.Format(time.RFC3339)
-		format = fmt.Sprintf("%s %s", rfct, format)
+	if l.Color && c != nil {
+		c.EnableColor()
+		message = c.Sprint(message)
 	}
-	return format
+
+	io.WriteString(w, message)
+}
+
+// writeJSON writes v as a single line of JSON to w.
+func (l *Logger) writeJSON(w io.Writer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	w.Write(append(b, '\n'))
+}
+
+// Log will print a formatted generic statement to standard output.
+func Log(format string, a ...interface{}) {
+	std().Log(format, a...)
+}
+
+// Table will print headers and data in a pretty formatted ASCII table to
+// standard output.
+func Table(headers []string, data [][]string) {
+	std().Table(headers, data)
+}
+
+// Ask will always print a formatted generic statement to standard error
+// formatted to be a question.
+func Ask(format string, a ...interface{}) {
+	std().Ask(format, a...)
+}
+
+// Always will "always" print a formatted generic statement to standard output.
+func Always(format string, a ...interface{}) {
+	std().Always(format, a...)
+}
+
+// Critical will print a formatted generic statement to standard error if the
+// default level is set to 1 or higher.
+func Critical(format string, a ...interface{}) {
+	std().Critical(format, a...)
+}
+
+// Info will print a formatted generic statement to standard error if the
+// default level is set to 3 or higher.
+func Info(format string, a ...interface{}) {
+	std().Info(format, a...)
+}
+
+// Success will print a formatted generic statement to standard error if the
+// default level is set to 3 or higher.
+func Success(format string, a ...interface{}) {
+	std().Success(format, a...)
+}
+
+// Debug will print a formatted generic statement to standard error if the
+// default level is set to 4 or higher.
+func Debug(format string, a ...interface{}) {
+	std().Debug(format, a...)
+}
+
+// Warning will print a formatted generic statement to standard error if the
+// default level is set to 2 or higher.
+func Warning(format string, a ...interface{}) {
+	std().Warning(format, a...)
 }
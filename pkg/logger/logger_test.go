@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		level int
+		want  []string
+	}{
+		{0, nil},
+		{1, []string{"critical"}},
+		{2, []string{"critical", "warning"}},
+		{3, []string{"critical", "warning", "info", "success"}},
+		{4, []string{"critical", "warning", "info", "success", "debug"}},
+	}
+
+	for _, test := range tests {
+		var out, err bytes.Buffer
+		l := New(&out, &err)
+		l.Level, l.Color = test.level, false
+
+		l.Critical("critical")
+		l.Warning("warning")
+		l.Info("info")
+		l.Success("success")
+		l.Debug("debug")
+
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(err.String()), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				got = append(got, fields[len(fields)-1])
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("level %d logged %v, want %v", test.level, got, test.want)
+		}
+		if out.Len() > 0 {
+			t.Errorf("level %d wrote diagnostics to Out: %q", test.level, out.String())
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	var out, err bytes.Buffer
+	l := New(&out, &err)
+	l.Level, l.Color = 0, false
+
+	l.Log("data %d", 1)
+	l.Always("always")
+	l.Ask("question?")
+
+	if want := "data 1\n[" + AlwaysLabel + "]  always\n"; out.String() != want {
+		t.Errorf("Out = %q, want %q", out.String(), want)
+	}
+	if want := "[" + AskLabel + "]  question?\n"; err.String() != want {
+		t.Errorf("Err = %q, want %q", err.String(), want)
+	}
+}
+
+func TestWriterArgument(t *testing.T) {
+	var out, err, w bytes.Buffer
+	l := New(&out, &err)
+	l.Color = false
+
+	l.Info("to %s", "writer", &w)
+
+	if want := "[" + InfoLabel + "]  to writer\n"; w.String() != want {
+		t.Errorf("writer = %q, want %q", w.String(), want)
+	}
+	if out.Len() > 0 || err.Len() > 0 {
+		t.Errorf("statement was written to Out %q or Err %q", out.String(), err.String())
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	tests := []struct {
+		name       string
+		color      bool
+		timestamps bool
+		check      func(string) bool
+	}{
+		{"plain", false, false, func(s string) bool { return s == "["+WarningLabel+"]  100% done\n" }},
+		{"color", true, false, func(s string) bool { return strings.HasPrefix(s, "\x1b[") && strings.Contains(s, "100% done") }},
+		{"timestamps", false, true, func(s string) bool {
+			fields := strings.SplitN(s, " ", 2)
+			return len(fields) == 2 && strings.Contains(fields[0], "T") && fields[1] == "["+WarningLabel+"]  100% done\n"
+		}},
+	}
+
+	for _, test := range tests {
+		var err bytes.Buffer
+		l := New(nil, &err)
+		l.Color, l.Timestamps = test.color, test.timestamps
+
+		l.Warning("%d%% done", 100)
+		if !test.check(err.String()) {
+			t.Errorf("%s: got %q", test.name, err.String())
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var out, err bytes.Buffer
+	l := New(&out, &err)
+	l.JSON = true
+
+	l.Warning("careful\n")
+	l.Table([]string{"Profile", "Session State"}, [][]string{{"cowboy", "valid"}})
+
+	var e entry
+	if jerr := json.Unmarshal(err.Bytes(), &e); jerr != nil || e.Level != "warning" || e.Message != "careful" || e.Time == "" {
+		t.Errorf("Err = %q, %v", err.String(), jerr)
+	}
+	if want := `{"profile":"cowboy","session_state":"valid"}` + "\n"; out.String() != want {
+		t.Errorf("Out = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+const (
+	// CredentialsPath is the path of the ECS container credentials endpoint.
+	CredentialsPath = "/credentials"
+
+	imdsTokenPath       = "/latest/api/token"
+	imdsCredentialsPath = "/latest/meta-data/iam/security-credentials/"
+
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	imdsMaxTokenTTL    = 6 * time.Hour
+)
+
+// CredentialsFunc returns the current session credentials. It is called for
+// every request, so it always serves the latest session.
+type CredentialsFunc func() (aws.Profile, error)
+
+// Server serves session credentials over the HTTP contracts of the ECS
+// container credentials endpoint and, optionally, of the EC2 instance metadata
+// service (IMDSv2).
+type Server struct {
+	// Name is the name IMDS reports for the instance's role.
+	Name string
+	// Token authorizes requests to the ECS endpoint, see
+	// AWS_CONTAINER_AUTHORIZATION_TOKEN.
+	Token string
+	// IMDS enables the IMDSv2 endpoints.
+	IMDS bool
+	// Credentials provides the credentials that are served.
+	Credentials CredentialsFunc
+
+	mu         sync.Mutex
+	imdsTokens map[string]time.Time
+}
+
+// CheckIMDSAddress ensures the IMDS endpoints are only served on a loopback or
+// link-local address. Like the real IMDS they require no authorization token,
+// so anything that can reach the address can read the credentials.
+func CheckIMDSAddress(address string) error {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid address: %s", address)
+	}
+	if addr.IP == nil || !(addr.IP.IsLoopback() || addr.IP.IsLinkLocalUnicast()) {
+		return errors.Errorf("the IMDS endpoints can only be served on a loopback or link-local address, not %s", address)
+	}
+	return nil
+}
+
+// NewToken returns a random token to authorize requests with.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate token")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == CredentialsPath:
+		s.serveECS(w, r)
+	case s.IMDS && r.URL.Path == imdsTokenPath:
+		s.serveIMDSToken(w, r)
+	case s.IMDS && strings.HasPrefix(r.URL.Path, imdsCredentialsPath):
+		s.serveIMDSCredentials(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ecsCredentials is the response of the ECS container credentials endpoint.
+type ecsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+// ecsError is an error response the AWS SDKs understand.
+type ecsError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *Server) serveECS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ecsError{Code: "MethodNotAllowed", Message: "only GET is allowed"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.Token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, ecsError{Code: "Unauthorized", Message: "invalid authorization token"})
+		return
+	}
+
+	creds, expiration, err := s.credentials()
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, ecsError{Code: errorCode(err), Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ecsCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+		Expiration:      expiration,
+	})
+}
+
+func (s *Server) serveIMDSToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "only PUT is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Like IMDS, refuse requests that were forwarded, e.g. by a proxy.
+	if r.Header.Get("X-Forwarded-For") != "" {
+		http.Error(w, "forwarded requests are not allowed", http.StatusForbidden)
+		return
+	}
+
+	ttl, err := strconv.Atoi(r.Header.Get(imdsTokenTTLHeader))
+	if err != nil || ttl <= 0 || time.Duration(ttl)*time.Second > imdsMaxTokenTTL {
+		http.Error(w, "invalid "+imdsTokenTTLHeader, http.StatusBadRequest)
+		return
+	}
+
+	token, err := NewToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	if s.imdsTokens == nil {
+		s.imdsTokens = map[string]time.Time{}
+	}
+	now := time.Now()
+	for t, expiration := range s.imdsTokens {
+		if now.After(expiration) {
+			delete(s.imdsTokens, t)
+		}
+	}
+	s.imdsTokens[token] = now.Add(time.Duration(ttl) * time.Second)
+	s.mu.Unlock()
+
+	w.Header().Set(imdsTokenTTLHeader, strconv.Itoa(ttl))
+	w.Write([]byte(token))
+}
+
+// imdsCredentials is the response of the IMDS security credentials endpoint.
+type imdsCredentials struct {
+	Code            string `json:"Code"`
+	LastUpdated     string `json:"LastUpdated"`
+	Type            string `json:"Type"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+}
+
+func (s *Server) serveIMDSCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.validIMDSToken(r.Header.Get(imdsTokenHeader)) {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, imdsCredentialsPath)
+	if name == "" {
+		w.Write([]byte(s.Name))
+		return
+	}
+	if name != s.Name {
+		http.NotFound(w, r)
+		return
+	}
+
+	creds, expiration, err := s.credentials()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, imdsCredentials{
+		Code:            "Success",
+		LastUpdated:     time.Now().UTC().Format(time.RFC3339),
+		Type:            "AWS-HMAC",
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+		Expiration:      expiration,
+	})
+}
+
+func (s *Server) validIMDSToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiration, ok := s.imdsTokens[token]
+	return ok && time.Now().Before(expiration)
+}
+
+// credentials returns the current credentials and their expiration. Expired
+// credentials are never served.
+func (s *Server) credentials() (aws.Profile, string, error) {
+	creds, err := s.Credentials()
+	if err != nil {
+		return aws.Profile{}, "", err
+	}
+
+	expiration, ok := creds.SessionExpiration()
+	if !ok {
+		return creds, "", nil
+	}
+	if !time.Now().Before(expiration) {
+		return aws.Profile{}, "", &aws.Error{Kind: aws.ErrorExpiredSession, Err: errors.New("the session has expired, run awsctl auth")}
+	}
+	return creds, expiration.UTC().Format(time.RFC3339), nil
+}
+
+// errorCode returns the code of error responses.
+func errorCode(err error) string {
+	if aws.KindOf(err) == aws.ErrorExpiredSession {
+		return "ExpiredToken"
+	}
+	return "CredentialsUnavailable"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+const testToken = "secret-token"
+
+// newTestServer serves the session with both the ECS and IMDS endpoints.
+func newTestServer(session aws.Profile) *httptest.Server {
+	return httptest.NewServer(&Server{
+		Name:  "cowboy",
+		Token: testToken,
+		IMDS:  true,
+		Credentials: func() (aws.Profile, error) {
+			return session, nil
+		},
+	})
+}
+
+func testSession(expiration time.Time) aws.Profile {
+	return aws.Profile{
+		AccessKeyID:              "ASIAEXAMPLE",
+		SecretAccessKey:          "secret",
+		SessionToken:             "token",
+		AuthenticationExpiration: expiration.Format(time.RFC3339),
+	}
+}
+
+// getECSCredentials gets credentials the way the AWS SDKs do with
+// AWS_CONTAINER_CREDENTIALS_FULL_URI and AWS_CONTAINER_AUTHORIZATION_TOKEN.
+func getECSCredentials(url, token string) (credentials.Value, error) {
+	provider := endpointcreds.NewProviderClient(*defaults.Config().WithMaxRetries(0), defaults.Handlers(), url+CredentialsPath,
+		func(p *endpointcreds.Provider) {
+			p.AuthorizationToken = token
+		})
+	return credentials.NewCredentials(provider).Get()
+}
+
+// getIMDSCredentials gets credentials the way the AWS SDKs do on EC2.
+func getIMDSCredentials(url string) (credentials.Value, error) {
+	config := defaults.Config().WithEndpoint(url).WithMaxRetries(0)
+	client := ec2metadata.NewClient(*config, defaults.Handlers(), url, "us-east-1")
+	return ec2rolecreds.NewCredentialsWithClient(client).Get()
+}
+
+func TestServeECS(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	srv := newTestServer(testSession(expiration))
+	defer srv.Close()
+
+	creds, err := getECSCredentials(srv.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIAEXAMPLE" || creds.SecretAccessKey != "secret" || creds.SessionToken != "token" {
+		t.Errorf("got credentials %+v", creds)
+	}
+
+	if _, err = getECSCredentials(srv.URL, "wrong-token"); err == nil {
+		t.Error("credentials were served with a wrong authorization token")
+	}
+}
+
+func TestServeECSExpired(t *testing.T) {
+	srv := newTestServer(testSession(time.Now().Add(-time.Minute)))
+	defer srv.Close()
+
+	if _, err := getECSCredentials(srv.URL, testToken); err == nil {
+		t.Error("expired credentials were served")
+	}
+}
+
+func TestServeIMDS(t *testing.T) {
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	srv := newTestServer(testSession(expiration))
+	defer srv.Close()
+
+	creds, err := getIMDSCredentials(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIAEXAMPLE" || creds.SecretAccessKey != "secret" || creds.SessionToken != "token" {
+		t.Errorf("got credentials %+v", creds)
+	}
+}
+
+func TestServeIMDSWithoutToken(t *testing.T) {
+	srv := newTestServer(testSession(time.Now().Add(time.Hour)))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + imdsCredentialsPath + "cowboy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d without an IMDS token, want 401", resp.StatusCode)
+	}
+}
+
+func TestCheckIMDSAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		err     bool
+	}{
+		{"127.0.0.1:9911", false},
+		{"127.0.0.2:9911", false},
+		{"[::1]:9911", false},
+		{"169.254.170.2:80", false},
+		{"[fe80::1]:80", false},
+		{":9911", true},
+		{"0.0.0.0:9911", true},
+		{"[::]:9911", true},
+		{"192.168.1.10:9911", true},
+		{"10.0.0.1:80", true},
+		{"127.0.0.1", true},
+	}
+
+	for _, test := range tests {
+		if err := CheckIMDSAddress(test.address); (err != nil) != test.err {
+			t.Errorf("CheckIMDSAddress(%q) = %v, want error %v", test.address, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/outlawlabs/awsctl/pkg/aws"
+)
+
+const (
+	// KeyDuration is the duration of new MFA sessions, e.g. 12h.
+	KeyDuration = "duration"
+	// KeyOutput is the output format, "table" or "json".
+	KeyOutput = "output"
+	// KeySessionTemplate is the naming template of MFA session profiles.
+	KeySessionTemplate = "session_template"
+
+	globalSection = "global"
+	profilePrefix = "profile "
+)
+
+// keys describes every known setting: whether it may be set per profile and
+// how its values are validated.
+var keys = map[string]struct {
+	perProfile bool
+	validate   func(value string) error
+}{
+	KeyDuration: {
+		perProfile: true,
+		validate: func(value string) error {
+			d, err := aws.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			return aws.GetSessionTokenLimits.Validate(d)
+		},
+	},
+	KeyOutput: {
+		validate: func(value string) error {
+			if value != "table" && value != "json" {
+				return errors.Errorf("%s must be %q or %q, not %q", KeyOutput, "table", "json", value)
+			}
+			return nil
+		},
+	},
+	KeySessionTemplate: {
+		validate: func(value string) error {
+			_, err := aws.SessionName(value, "profile")
+			return err
+		},
+	},
+}
+
+// Setting is a single value of the settings file. Profile is empty for global
+// settings.
+type Setting struct {
+	Profile string
+	Key     string
+	Value   string
+}
+
+// Settings holds the user's defaults for awsctl. The file has a "global"
+// section and a "profile NAME" section per profile, e.g.
+//
+//	[global]
+//	duration = 12h
+//
+//	[profile cowboy]
+//	duration = 1h
+type Settings struct {
+	file     *aws.File
+	filename string
+}
+
+// DefaultPath returns the location of the settings file, following the XDG
+// base directory specification.
+func DefaultPath() string {
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return filepath.Join(config, "awsctl", "config")
+	}
+	return "~/.config/awsctl/config"
+}
+
+// Load reads the settings file. A missing file holds no settings.
+func Load(filename string) (*Settings, error) {
+	file, err := aws.LoadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read settings file")
+	}
+	return &Settings{file: file, filename: filename}, nil
+}
+
+func section(profile string) string {
+	if profile == "" {
+		return globalSection
+	}
+	return profilePrefix + profile
+}
+
+// Validate checks the key, and the value unless it is empty, of a setting.
+func Validate(profile, key, value string) error {
+	k, ok := keys[key]
+	if !ok {
+		return errors.Errorf("unknown setting: %s", key)
+	}
+	if profile != "" && !k.perProfile {
+		return errors.Errorf("%s cannot be set per profile", key)
+	}
+	if value == "" {
+		return nil
+	}
+	return k.validate(value)
+}
+
+// Get returns the value of the setting for the profile, falling back to the
+// global value. Without a profile only the global value is returned.
+func (s *Settings) Get(profile, key string) string {
+	if profile != "" {
+		if value := s.file.Section(section(profile)).Value(key); value != "" {
+			return value
+		}
+	}
+	return s.file.Section(globalSection).Value(key)
+}
+
+// Set sets the global setting, or the setting of the profile, after validating
+// it. Setting an empty value removes the setting.
+func (s *Settings) Set(profile, key, value string) error {
+	if err := Validate(profile, key, value); err != nil {
+		return err
+	}
+
+	if value == "" {
+		if sec := s.file.Section(section(profile)); sec != nil {
+			sec.DeleteKey(key)
+		}
+		return nil
+	}
+
+	s.file.EnsureSection(section(profile)).SetValue(key, value)
+	return nil
+}
+
+// List returns every setting of the file, global settings first.
+func (s *Settings) List() []Setting {
+	var settings []Setting
+	for _, sec := range s.file.Sections() {
+		var profile string
+		switch {
+		case sec.Name() == globalSection:
+		case strings.HasPrefix(sec.Name(), profilePrefix):
+			profile = strings.TrimSpace(strings.TrimPrefix(sec.Name(), profilePrefix))
+		default:
+			continue
+		}
+		for _, k := range sec.Keys() {
+			settings = append(settings, Setting{Profile: profile, Key: k.Name, Value: k.Value})
+		}
+	}
+
+	sort.SliceStable(settings, func(i, j int) bool {
+		return settings[i].Profile == "" && settings[j].Profile != ""
+	})
+	return settings
+}
+
+// Save writes the settings file, creating its directory if needed.
+func (s *Settings) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0700); err != nil {
+		return errors.Wrapf(err, "failed to make directory: %s", filepath.Dir(s.filename))
+	}
+	return errors.Wrap(s.file.SaveTo(s.filename), "failed to save settings file")
+}
@@ -0,0 +1,103 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		profile string
+		key     string
+		value   string
+		err     bool
+	}{
+		{"", KeyDuration, "12h", false},
+		{"cowboy", KeyDuration, "1h", false},
+		{"", KeyDuration, "5m", true},
+		{"", KeyDuration, "forever", true},
+		{"", KeyOutput, "json", false},
+		{"", KeyOutput, "yaml", true},
+		{"cowboy", KeyOutput, "json", true},
+		{"", KeySessionTemplate, "{{.Name}}-mfa", false},
+		{"", KeySessionTemplate, "{{.Name", true},
+		{"cowboy", KeySessionTemplate, "{{.Name}}-mfa", true},
+		{"", "color", "always", true},
+		// An empty value removes the setting.
+		{"", KeyOutput, "", false},
+	}
+
+	for _, test := range tests {
+		if err := Validate(test.profile, test.key, test.value); (err != nil) != test.err {
+			t.Errorf("Validate(%q, %q, %q) = %v, want error %v", test.profile, test.key, test.value, err, test.err)
+		}
+	}
+}
+
+func TestSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awsctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "awsctl", "config")
+
+	s, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setting := range []Setting{
+		{"cowboy", KeyDuration, "1h"},
+		{"", KeyDuration, "8h"},
+		{"", KeyOutput, "json"},
+	} {
+		if err = s.Set(setting.Profile, setting.Key, setting.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Set("", KeyOutput, "yaml"); err == nil {
+		t.Error("invalid setting was set")
+	}
+	if err = s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = Load(filename); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		profile string
+		key     string
+		want    string
+	}{
+		{"cowboy", KeyDuration, "1h"},
+		{"other", KeyDuration, "8h"},
+		{"", KeyDuration, "8h"},
+		{"cowboy", KeyOutput, "json"},
+		{"", KeySessionTemplate, ""},
+	}
+	for _, test := range tests {
+		if got := s.Get(test.profile, test.key); got != test.want {
+			t.Errorf("Get(%q, %q) = %q, want %q", test.profile, test.key, got, test.want)
+		}
+	}
+
+	want := []Setting{
+		{"", KeyDuration, "8h"},
+		{"", KeyOutput, "json"},
+		{"cowboy", KeyDuration, "1h"},
+	}
+	if got := s.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %+v, want %+v", got, want)
+	}
+
+	if err = s.Set("cowboy", KeyDuration, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Get("cowboy", KeyDuration); got != "8h" {
+		t.Errorf("removed setting of cowboy = %q, want the global 8h", got)
+	}
+}